@@ -7,12 +7,21 @@ import (
 
 // WorkerBuilder is the builder of Worker.
 type WorkerBuilder struct {
-	WorkerQueue         arachne.WorkerQueue
-	Logger              arachne.Logger
-	HTTPClient          arachne.HTTPClient
-	RequestMiddlewares  []func(request *arachne.Request)
-	ResponseMiddlewares []func(response *arachne.Response)
-	Spider              func(response *arachne.Response) ([]*arachne.Request, error)
+	WorkerQueue           arachne.WorkerQueue
+	Logger                arachne.Logger
+	HTTPClient            arachne.HTTPClient
+	RequestMiddlewares    []func(request *arachne.Request)
+	ResponseMiddlewares   []func(response *arachne.Response)
+	Middlewares           []arachne.RequestMiddleware
+	DownloaderMiddlewares []arachne.DownloaderMiddleware
+	Spider                func(response *arachne.Response) ([]*arachne.Request, error)
+	ItemSpider            arachne.ItemSpider
+	ItemPipelines         []arachne.ItemPipeline
+	MaxAttempts           int
+	RetryPolicy           *arachne.RetryPolicy
+	FetchConcurrency      int
+	SpiderConcurrency     int
+	DupeFilter            arachne.DupeFilter
 }
 
 // NewWorkerBuilder is builder of the WorkerBuilder that initialize fields by default values.
@@ -32,7 +41,7 @@ func (w *WorkerBuilder) Build() (*arachne.Worker, error) {
 	if w.HTTPClient == nil {
 		return nil, xerrors.New("set http client")
 	}
-	if w.Spider == nil {
+	if w.Spider == nil && w.ItemSpider == nil {
 		return nil, xerrors.New("set spider")
 	}
 	if w.RequestMiddlewares == nil {
@@ -42,12 +51,21 @@ func (w *WorkerBuilder) Build() (*arachne.Worker, error) {
 		w.ResponseMiddlewares = make([]func(*arachne.Response), 0)
 	}
 	return &arachne.Worker{
-		WorkerQueue:         w.WorkerQueue,
-		HTTPClient:          w.HTTPClient,
-		Logger:              w.Logger,
-		RequestMiddlewares:  w.RequestMiddlewares,
-		ResponseMiddlewares: w.ResponseMiddlewares,
-		Spider:              w.Spider,
+		WorkerQueue:           w.WorkerQueue,
+		HTTPClient:            w.HTTPClient,
+		Logger:                w.Logger,
+		RequestMiddlewares:    w.RequestMiddlewares,
+		ResponseMiddlewares:   w.ResponseMiddlewares,
+		Middlewares:           w.Middlewares,
+		DownloaderMiddlewares: w.DownloaderMiddlewares,
+		Spider:                w.Spider,
+		ItemSpider:            w.ItemSpider,
+		ItemPipelines:         w.ItemPipelines,
+		MaxAttempts:           w.MaxAttempts,
+		RetryPolicy:           w.RetryPolicy,
+		FetchConcurrency:      w.FetchConcurrency,
+		SpiderConcurrency:     w.SpiderConcurrency,
+		DupeFilter:            w.DupeFilter,
 	}, nil
 }
 
@@ -74,3 +92,63 @@ func (w *WorkerBuilder) SetSpider(f func(response *arachne.Response) ([]*arachne
 	w.Spider = f
 	return w
 }
+
+// SetItemSpider sets the spider that extracts items as well as requests. It is used instead of the spider
+func (w *WorkerBuilder) SetItemSpider(f arachne.ItemSpider) *WorkerBuilder {
+	w.ItemSpider = f
+	return w
+}
+
+// AddItemPipeline appends the stage to the item pipelines
+func (w *WorkerBuilder) AddItemPipeline(pipeline arachne.ItemPipeline) *WorkerBuilder {
+	w.ItemPipelines = append(w.ItemPipelines, pipeline)
+	return w
+}
+
+// SetCallbacks sets the item spider that dispatches responses to the callbacks of the registry
+func (w *WorkerBuilder) SetCallbacks(registry *arachne.CallbackRegistry) *WorkerBuilder {
+	w.ItemSpider = registry.ItemSpider
+	return w
+}
+
+// SetFetchConcurrency sets the number of goroutines that fetch requests
+func (w *WorkerBuilder) SetFetchConcurrency(concurrency int) *WorkerBuilder {
+	w.FetchConcurrency = concurrency
+	return w
+}
+
+// SetSpiderConcurrency sets the number of goroutines that apply the spider
+func (w *WorkerBuilder) SetSpiderConcurrency(concurrency int) *WorkerBuilder {
+	w.SpiderConcurrency = concurrency
+	return w
+}
+
+// AddMiddleware appends the middleware applied to requests before they are fetched
+func (w *WorkerBuilder) AddMiddleware(middleware arachne.RequestMiddleware) *WorkerBuilder {
+	w.Middlewares = append(w.Middlewares, middleware)
+	return w
+}
+
+// AddDownloaderMiddleware appends the middleware that wraps the http client. The first one is the outermost layer
+func (w *WorkerBuilder) AddDownloaderMiddleware(middleware arachne.DownloaderMiddleware) *WorkerBuilder {
+	w.DownloaderMiddlewares = append(w.DownloaderMiddlewares, middleware)
+	return w
+}
+
+// SetMaxAttempts sets the number of retries after which a request is sent to the dead letter queue
+func (w *WorkerBuilder) SetMaxAttempts(maxAttempts int) *WorkerBuilder {
+	w.MaxAttempts = maxAttempts
+	return w
+}
+
+// SetRetryPolicy sets the policy that retries failed fetches with backoff
+func (w *WorkerBuilder) SetRetryPolicy(policy *arachne.RetryPolicy) *WorkerBuilder {
+	w.RetryPolicy = policy
+	return w
+}
+
+// SetDupeFilter sets DupeFilter that drops requests seen before publishing them
+func (w *WorkerBuilder) SetDupeFilter(dupeFilter arachne.DupeFilter) *WorkerBuilder {
+	w.DupeFilter = dupeFilter
+	return w
+}
@@ -33,3 +33,49 @@ func TestWorkerBuilder_BuildSuccess(t *testing.T) {
 		t.Fatalf("expected nil, but got error: %v", err)
 	}
 }
+
+func TestWorkerBuilder_BuildItemSpider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pipeline := arachne.ItemPipelineFunc(func(item arachne.Item, _ *arachne.Response) (arachne.Item, error) {
+		return item, nil
+	})
+	builder := NewWorkerBuilder()
+	builder.SetHTTPClient(arachne.NewMockHTTPClient(ctrl))
+	builder.SetLogger(arachne.NewMockLogger(ctrl))
+	builder.SetWorkerQueue(arachne.NewMockWorkerQueue(ctrl))
+	builder.SetItemSpider(func(*arachne.Response) (*arachne.SpiderOutput, error) { return nil, nil })
+	builder.AddItemPipeline(pipeline).AddItemPipeline(pipeline)
+	worker, err := builder.Build()
+	if err != nil {
+		t.Fatalf("expected nil, but got error: %v", err)
+	}
+	if len(worker.ItemPipelines) != 2 {
+		t.Fatalf("expected 2 item pipelines, but got %d", len(worker.ItemPipelines))
+	}
+}
+
+func TestWorkerBuilder_BuildCallbacks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	registry := arachne.NewCallbackRegistry().
+		RegisterItemCallback("", func(*arachne.Response) (*arachne.SpiderOutput, error) {
+			return &arachne.SpiderOutput{Items: []arachne.Item{{"title": "Go"}}}, nil
+		})
+	builder := NewWorkerBuilder()
+	builder.SetHTTPClient(arachne.NewMockHTTPClient(ctrl))
+	builder.SetLogger(arachne.NewMockLogger(ctrl))
+	builder.SetWorkerQueue(arachne.NewMockWorkerQueue(ctrl))
+	builder.SetCallbacks(registry)
+	worker, err := builder.Build()
+	if err != nil {
+		t.Fatalf("expected nil, but got error: %v", err)
+	}
+	request, _ := arachne.NewGetRequest("https://golang.org/")
+	output, err := worker.ItemSpider(&arachne.Response{StatusCode: 200, Request: request})
+	if err != nil || len(output.Items) != 1 {
+		t.Fatalf("expected the item of the callback, but got %v and %v", output, err)
+	}
+}
@@ -0,0 +1,121 @@
+package arachne
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrNoResponse is the error passed to the errback of a request whose response could not be fetched.
+var ErrNoResponse = xerrors.New("no response")
+
+// Callback extracts the next requests from the response, like Worker.Spider.
+type Callback func(response *Response) ([]*Request, error)
+
+// ItemCallback extracts the next requests and items from the response, like Worker.ItemSpider.
+type ItemCallback func(response *Response) (*SpiderOutput, error)
+
+// Errback handles a request that failed. err is ErrNoResponse if the response could not be fetched,
+// or the error of the callback otherwise.
+type Errback func(response *Response, err error) ([]*Request, error)
+
+// CallbackRegistry dispatches responses to the callbacks named by Request.Callback.
+// Because requests carry names instead of functions, the routing survives serialization through any WorkerQueue.
+type CallbackRegistry struct {
+	mutex     sync.RWMutex
+	callbacks map[string]ItemCallback
+	errbacks  map[string]Errback
+}
+
+// NewCallbackRegistry creates an empty CallbackRegistry.
+func NewCallbackRegistry() *CallbackRegistry {
+	return &CallbackRegistry{
+		callbacks: map[string]ItemCallback{},
+		errbacks:  map[string]Errback{},
+	}
+}
+
+// Register registers the callback with the name.
+// The callback registered with "" handles requests without Request.Callback.
+func (r *CallbackRegistry) Register(name string, callback Callback) *CallbackRegistry {
+	return r.RegisterItemCallback(name, func(response *Response) (*SpiderOutput, error) {
+		requests, err := callback(response)
+		return &SpiderOutput{Requests: requests}, err
+	})
+}
+
+// RegisterItemCallback registers the callback that extracts items as well with the name.
+// It replaces the callback registered by Register with the same name.
+func (r *CallbackRegistry) RegisterItemCallback(name string, callback ItemCallback) *CallbackRegistry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.callbacks[name] = callback
+	return r
+}
+
+// RegisterErrback registers the errback with the name.
+// The errback registered with "" handles requests without Request.Errback.
+func (r *CallbackRegistry) RegisterErrback(name string, errback Errback) *CallbackRegistry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errbacks[name] = errback
+	return r
+}
+
+// Spider dispatches the response to the callback of its request, and can be used as Worker.Spider.
+// If the response could not be fetched or the callback fails, the response goes to the errback of the request.
+// It fails if the callback or the errback is not registered.
+// The items of the callbacks registered by RegisterItemCallback are discarded, so use ItemSpider for them.
+func (r *CallbackRegistry) Spider(response *Response) ([]*Request, error) {
+	output, err := r.ItemSpider(response)
+	return output.Requests, err
+}
+
+// ItemSpider is Spider that outputs the items of the callbacks as well, and can be used as Worker.ItemSpider.
+// The output is not nil even if it fails.
+func (r *CallbackRegistry) ItemSpider(response *Response) (*SpiderOutput, error) {
+	request := response.Request
+	if request.isRetry() {
+		// RetryMiddleware has sent the request back to the WorkerQueue.
+		return &SpiderOutput{}, nil
+	}
+	if response.StatusCode == 0 {
+		return r.handleError(response, ErrNoResponse)
+	}
+	r.mutex.RLock()
+	callback, ok := r.callbacks[request.Callback]
+	r.mutex.RUnlock()
+	if !ok {
+		return &SpiderOutput{}, xerrors.Errorf("callback %q of %s is not registered", request.Callback, request.URL)
+	}
+	output, err := callback(response)
+	if err != nil {
+		return r.handleError(response, err)
+	}
+	if output == nil {
+		output = &SpiderOutput{}
+	}
+	return output, nil
+}
+
+func (r *CallbackRegistry) handleError(response *Response, err error) (*SpiderOutput, error) {
+	request := response.Request
+	r.mutex.RLock()
+	errback, ok := r.errbacks[request.Errback]
+	r.mutex.RUnlock()
+	if !ok && request.Errback != "" {
+		return &SpiderOutput{}, xerrors.Errorf("errback %q of %s is not registered", request.Errback, request.URL)
+	}
+	if !ok {
+		if err == ErrNoResponse {
+			// without an errback, a request without response outputs nothing as Spider does.
+			return &SpiderOutput{}, nil
+		}
+		return &SpiderOutput{}, xerrors.Errorf("callback %q of %s fails: %w", request.Callback, request.URL, err)
+	}
+	requests, errbackErr := errback(response, err)
+	if errbackErr != nil {
+		return &SpiderOutput{Requests: requests}, xerrors.Errorf("errback %q of %s fails: %w", request.Errback, request.URL, errbackErr)
+	}
+	return &SpiderOutput{Requests: requests}, nil
+}
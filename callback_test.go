@@ -0,0 +1,119 @@
+package arachne
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestCallbackRegistry_Spider(t *testing.T) {
+	called := ""
+	errbackError := error(nil)
+	registry := NewCallbackRegistry().
+		Register("", func(response *Response) ([]*Request, error) {
+			called = "default"
+			return nil, nil
+		}).
+		Register("detail", func(response *Response) ([]*Request, error) {
+			called = "detail"
+			next, _ := NewGetRequest("https://golang.org/next")
+			return []*Request{next}, nil
+		}).
+		Register("broken", func(response *Response) ([]*Request, error) {
+			called = "broken"
+			return nil, xerrors.New("broken page")
+		}).
+		RegisterErrback("report", func(response *Response, err error) ([]*Request, error) {
+			errbackError = err
+			return nil, nil
+		})
+
+	newResponse := func(statusCode int, callback, errback string) *Response {
+		request, _ := NewGetRequest("https://golang.org/")
+		request.Callback = callback
+		request.Errback = errback
+		// the callback name survives serialization.
+		data, _ := json.Marshal(request)
+		decoded := new(Request)
+		_ = json.Unmarshal(data, decoded)
+		return &Response{StatusCode: statusCode, Request: decoded}
+	}
+
+	tests := []struct {
+		response        *Response
+		expectedCalled  string
+		expectedNum     int
+		expectedIsError bool
+		expectedErrback error
+	}{
+		{newResponse(200, "", ""), "default", 0, false, nil},
+		{newResponse(200, "detail", ""), "detail", 1, false, nil},
+		{newResponse(200, "unknown", ""), "", 0, true, nil},
+		{newResponse(200, "broken", ""), "broken", 0, true, nil},
+		{newResponse(200, "broken", "report"), "broken", 0, false, nil},
+		{newResponse(0, "detail", "report"), "", 0, false, ErrNoResponse},
+		{newResponse(0, "detail", "unknown"), "", 0, true, nil},
+	}
+
+	for i, tt := range tests {
+		called = ""
+		errbackError = nil
+		requests, err := registry.Spider(tt.response)
+		if called != tt.expectedCalled || len(requests) != tt.expectedNum || (err != nil) != tt.expectedIsError {
+			t.Fatalf("test case %d: expected %q called, %d requests and error %v, but got %q, %d and %v",
+				i, tt.expectedCalled, tt.expectedNum, tt.expectedIsError, called, len(requests), err)
+		}
+		if tt.expectedErrback != nil && errbackError != tt.expectedErrback {
+			t.Fatalf("test case %d: expected errback with %v, but got %v", i, tt.expectedErrback, errbackError)
+		}
+	}
+}
+
+func TestCallbackRegistry_ItemSpider(t *testing.T) {
+	registry := NewCallbackRegistry().
+		Register("", func(response *Response) ([]*Request, error) {
+			next, _ := NewGetRequest("https://golang.org/next")
+			return []*Request{next}, nil
+		}).
+		RegisterItemCallback("detail", func(response *Response) (*SpiderOutput, error) {
+			next, _ := NewGetRequest("https://golang.org/next")
+			return &SpiderOutput{Requests: []*Request{next}, Items: []Item{{"title": "Go"}}}, nil
+		}).
+		RegisterItemCallback("empty", func(response *Response) (*SpiderOutput, error) {
+			return nil, nil
+		})
+
+	newResponse := func(callback string) *Response {
+		request, _ := NewGetRequest("https://golang.org/")
+		request.Callback = callback
+		return &Response{StatusCode: 200, Request: request}
+	}
+
+	tests := []struct {
+		callback         string
+		expectedRequests int
+		expectedItems    int
+	}{
+		{"", 1, 0},
+		{"detail", 1, 1},
+		{"empty", 0, 0},
+	}
+	for i, tt := range tests {
+		output, err := registry.ItemSpider(newResponse(tt.callback))
+		if err != nil || len(output.Requests) != tt.expectedRequests || len(output.Items) != tt.expectedItems {
+			t.Fatalf("test case %d: expected %d requests and %d items, but got %v and %v",
+				i, tt.expectedRequests, tt.expectedItems, output, err)
+		}
+	}
+
+	// Spider outputs the requests of an item callback
+	requests, err := registry.Spider(newResponse("detail"))
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("expected 1 request, but got %v and %v", requests, err)
+	}
+	output, err := registry.ItemSpider(newResponse("unknown"))
+	if err == nil || output == nil {
+		t.Fatalf("expected error with an empty output, but got %v and %v", output, err)
+	}
+}
@@ -0,0 +1,434 @@
+package arachne
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// binaryVersion is the version of the binary encoding of Request and Response.
+const binaryVersion = 1
+
+// requestJSON is the JSON representation of Request.
+type requestJSON struct {
+	URL       string                 `json:"url"`
+	Method    string                 `json:"method,omitempty"`
+	Header    http.Header            `json:"header,omitempty"`
+	Body      []byte                 `json:"body,omitempty"`
+	Priority  int64                  `json:"priority,omitempty"`
+	QueueName string                 `json:"queue_name,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	Attempts  int                    `json:"attempts,omitempty"`
+	NotBefore *time.Time             `json:"not_before,omitempty"`
+	Depth     int                    `json:"depth,omitempty"`
+	Referer   string                 `json:"referer,omitempty"`
+	SeedID    string                 `json:"seed_id,omitempty"`
+	Callback  string                 `json:"callback,omitempty"`
+	Errback   string                 `json:"errback,omitempty"`
+}
+
+// responseJSON is the JSON representation of Response.
+type responseJSON struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	Request    *Request    `json:"request,omitempty"`
+}
+
+// Validate reports whether the request can be decoded after it is encoded,
+// which queues check before they persist the request.
+func (r *Request) Validate() error {
+	_, err := parseRequestURL(r.URL)
+	return err
+}
+
+// MarshalJSON encodes the request as a JSON object with url and optionally method, header,
+// body (base64), priority, queue_name, meta, attempts, not_before, depth, referer, seed_id, callback and errback.
+// It fails if the url is not an absolute url.
+func (r *Request) MarshalJSON() ([]byte, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, xerrors.Errorf("fail to encode request: %w", err)
+	}
+	o := requestJSON{
+		URL:       r.URL,
+		Method:    r.Method,
+		Header:    r.Header,
+		Body:      r.Body,
+		Priority:  r.Priority,
+		QueueName: r.QueueName,
+		Meta:      r.Meta,
+		Attempts:  r.Attempts,
+		Depth:     r.Depth,
+		Referer:   r.Referer,
+		SeedID:    r.SeedID,
+		Callback:  r.Callback,
+		Errback:   r.Errback,
+	}
+	if !r.NotBefore.IsZero() {
+		o.NotBefore = &r.NotBefore
+	}
+	return json.Marshal(&o)
+}
+
+// UnmarshalJSON decodes the JSON object encoded by MarshalJSON and restores the parsed url.
+// Omitted fields have the same values as those of NewGetRequest.
+// It fails if the url is not an absolute url. Note that numbers in Meta are decoded as float64.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	o := requestJSON{}
+	err := json.Unmarshal(data, &o)
+	if err != nil {
+		return xerrors.Errorf("fail to decode request: %w", err)
+	}
+	requestURL, err := parseRequestURL(o.URL)
+	if err != nil {
+		return xerrors.Errorf("fail to decode request: %w", err)
+	}
+	*r = Request{
+		URL:        o.URL,
+		Method:     o.Method,
+		Header:     o.Header,
+		Body:       o.Body,
+		Priority:   o.Priority,
+		QueueName:  o.QueueName,
+		Meta:       o.Meta,
+		Attempts:   o.Attempts,
+		Depth:      o.Depth,
+		Referer:    o.Referer,
+		SeedID:     o.SeedID,
+		Callback:   o.Callback,
+		Errback:    o.Errback,
+		requestURL: requestURL,
+	}
+	if o.NotBefore != nil {
+		r.NotBefore = *o.NotBefore
+	}
+	r.setDefaults()
+	return nil
+}
+
+// MarshalBinary encodes the request in a compact binary format.
+// Meta is encoded as JSON, so numbers in Meta are decoded as float64.
+// Because Request implements encoding.BinaryMarshaler, encoding/gob uses this format as well.
+// It fails if the url is not an absolute url.
+func (r *Request) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.putUvarint(binaryVersion)
+	err := r.writeBinary(w)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to encode request %s: %w", r.URL, err)
+	}
+	return w.buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the request encoded by MarshalBinary and restores the parsed url.
+// It fails if the url is not an absolute url.
+func (r *Request) UnmarshalBinary(data []byte) error {
+	reader := &binaryReader{data: data}
+	err := reader.version()
+	if err == nil {
+		err = r.readBinary(reader)
+	}
+	if err != nil {
+		return xerrors.Errorf("fail to decode request: %w", err)
+	}
+	return nil
+}
+
+func (r *Request) writeBinary(w *binaryWriter) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+	w.putString(r.URL)
+	w.putString(r.Method)
+	w.putHeader(r.Header)
+	w.putBytes(r.Body)
+	w.putVarint(r.Priority)
+	w.putString(r.QueueName)
+	var meta []byte
+	if len(r.Meta) > 0 {
+		meta, err = json.Marshal(r.Meta)
+		if err != nil {
+			return xerrors.Errorf("fail to encode meta: %w", err)
+		}
+	}
+	w.putBytes(meta)
+	w.putUvarint(uint64(r.Attempts))
+	if r.NotBefore.IsZero() {
+		w.putUvarint(0)
+	} else {
+		w.putUvarint(1)
+		w.putVarint(r.NotBefore.UnixNano())
+	}
+	w.putUvarint(uint64(r.Depth))
+	w.putString(r.Referer)
+	w.putString(r.SeedID)
+	w.putString(r.Callback)
+	w.putString(r.Errback)
+	return nil
+}
+
+func (r *Request) readBinary(reader *binaryReader) error {
+	o := Request{}
+	o.URL = reader.string()
+	o.Method = reader.string()
+	o.Header = reader.header()
+	o.Body = reader.bytes()
+	o.Priority = reader.varint()
+	o.QueueName = reader.string()
+	meta := reader.bytes()
+	o.Attempts = int(reader.uvarint())
+	if reader.uvarint() != 0 {
+		o.NotBefore = time.Unix(0, reader.varint())
+	}
+	o.Depth = int(reader.uvarint())
+	o.Referer = reader.string()
+	o.SeedID = reader.string()
+	o.Callback = reader.string()
+	o.Errback = reader.string()
+	if reader.err != nil {
+		return reader.err
+	}
+	if len(meta) > 0 {
+		err := json.Unmarshal(meta, &o.Meta)
+		if err != nil {
+			return xerrors.Errorf("fail to decode meta: %w", err)
+		}
+	}
+	requestURL, err := parseRequestURL(o.URL)
+	if err != nil {
+		return err
+	}
+	o.requestURL = requestURL
+	o.setDefaults()
+	*r = o
+	return nil
+}
+
+// setDefaults sets the values of NewGetRequest to the empty fields.
+func (r *Request) setDefaults() {
+	if r.Method == "" {
+		r.Method = "GET"
+	}
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	if r.Body == nil {
+		r.Body = []byte{}
+	}
+	if r.QueueName == "" {
+		r.QueueName = "default"
+	}
+	if r.Meta == nil {
+		r.Meta = map[string]interface{}{}
+	}
+}
+
+// parseRequestURL parses the url of a decoded request and rejects urls that cannot be fetched.
+func parseRequestURL(rawURL string) (*url.URL, error) {
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, xerrors.Errorf("url %s is invalid: %w", rawURL, err)
+	}
+	if requestURL.Scheme == "" || requestURL.Host == "" {
+		return nil, xerrors.Errorf("url %s is not absolute", rawURL)
+	}
+	return requestURL, nil
+}
+
+// MarshalJSON encodes the response as a JSON object with status_code, headers, body (base64) and request.
+func (r *Response) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&responseJSON{
+		StatusCode: r.StatusCode,
+		Headers:    r.Headers,
+		Body:       r.Body,
+		Request:    r.Request,
+	})
+}
+
+// UnmarshalJSON decodes the JSON object encoded by MarshalJSON.
+func (r *Response) UnmarshalJSON(data []byte) error {
+	o := responseJSON{}
+	err := json.Unmarshal(data, &o)
+	if err != nil {
+		return xerrors.Errorf("fail to decode response: %w", err)
+	}
+	*r = Response{
+		StatusCode: o.StatusCode,
+		Headers:    o.Headers,
+		Body:       o.Body,
+		Request:    o.Request,
+	}
+	if r.Headers == nil {
+		r.Headers = http.Header{}
+	}
+	return nil
+}
+
+// MarshalBinary encodes the response in the compact binary format of Request.MarshalBinary.
+func (r *Response) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.putUvarint(binaryVersion)
+	w.putUvarint(uint64(r.StatusCode))
+	w.putHeader(r.Headers)
+	w.putBytes(r.Body)
+	if r.Request == nil {
+		w.putUvarint(0)
+	} else {
+		w.putUvarint(1)
+		err := r.Request.writeBinary(w)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to encode response of %s: %w", r.Request.URL, err)
+		}
+	}
+	return w.buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the response encoded by MarshalBinary.
+func (r *Response) UnmarshalBinary(data []byte) error {
+	reader := &binaryReader{data: data}
+	err := reader.version()
+	if err != nil {
+		return xerrors.Errorf("fail to decode response: %w", err)
+	}
+	o := Response{}
+	o.StatusCode = int(reader.uvarint())
+	o.Headers = reader.header()
+	o.Body = reader.bytes()
+	if reader.uvarint() != 0 {
+		o.Request = new(Request)
+		err = o.Request.readBinary(reader)
+		if err != nil {
+			return xerrors.Errorf("fail to decode response: %w", err)
+		}
+	}
+	if reader.err != nil {
+		return xerrors.Errorf("fail to decode response: %w", reader.err)
+	}
+	*r = o
+	return nil
+}
+
+type binaryWriter struct {
+	buffer  bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryWriter) putUvarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.buffer.Write(w.scratch[:n])
+}
+
+func (w *binaryWriter) putVarint(v int64) {
+	n := binary.PutVarint(w.scratch[:], v)
+	w.buffer.Write(w.scratch[:n])
+}
+
+func (w *binaryWriter) putBytes(b []byte) {
+	w.putUvarint(uint64(len(b)))
+	w.buffer.Write(b)
+}
+
+func (w *binaryWriter) putString(s string) {
+	w.putUvarint(uint64(len(s)))
+	w.buffer.WriteString(s)
+}
+
+func (w *binaryWriter) putHeader(header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.putUvarint(uint64(len(keys)))
+	for _, key := range keys {
+		w.putString(key)
+		w.putUvarint(uint64(len(header[key])))
+		for _, value := range header[key] {
+			w.putString(value)
+		}
+	}
+}
+
+// binaryReader reads the values written by binaryWriter.
+// After the first error, it returns zero values and keeps the error in err.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) version() error {
+	version := r.uvarint()
+	if r.err != nil {
+		return r.err
+	}
+	if version != binaryVersion {
+		return xerrors.Errorf("unknown binary version %d", version)
+	}
+	return nil
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = xerrors.New("binary data is broken")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = xerrors.New("binary data is broken")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)) < n {
+		r.err = xerrors.New("binary data is truncated")
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data[:n])
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *binaryReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *binaryReader) header() http.Header {
+	n := r.uvarint()
+	header := http.Header{}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		key := r.string()
+		m := r.uvarint()
+		for j := uint64(0); j < m && r.err == nil; j++ {
+			header[key] = append(header[key], r.string())
+		}
+	}
+	return header
+}
@@ -0,0 +1,184 @@
+package arachne
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestCodecRequest(t *testing.T) *Request {
+	request, err := NewGetRequest("https://golang.org/search?q=go")
+	if err != nil {
+		t.Fatalf("fail to create request")
+	}
+	request.Method = "POST"
+	request.Header.Add("Accept", "text/html")
+	request.Header.Add("Accept", "application/xhtml+xml")
+	request.Body = []byte("q=go")
+	request.Priority = -2
+	request.QueueName = "search"
+	request.Meta["page"] = "2"
+	request.Attempts = 1
+	request.NotBefore = time.Unix(1500000000, 0).UTC()
+	request.Depth = 2
+	request.Referer = "https://golang.org/"
+	request.SeedID = "seed"
+	request.Callback = "parseSearch"
+	request.Errback = "searchFailed"
+	return request
+}
+
+func assertSameRequest(t *testing.T, expected, actual *Request) {
+	t.Helper()
+	if actual.URL != expected.URL ||
+		actual.Method != expected.Method ||
+		!reflect.DeepEqual(actual.Header, expected.Header) ||
+		!bytes.Equal(actual.Body, expected.Body) ||
+		actual.Priority != expected.Priority ||
+		actual.QueueName != expected.QueueName ||
+		!reflect.DeepEqual(actual.Meta, expected.Meta) ||
+		actual.Attempts != expected.Attempts ||
+		!actual.NotBefore.Equal(expected.NotBefore) ||
+		actual.Depth != expected.Depth ||
+		actual.Referer != expected.Referer ||
+		actual.SeedID != expected.SeedID ||
+		actual.Callback != expected.Callback ||
+		actual.Errback != expected.Errback {
+		t.Fatalf("expected %+v, but got %+v", expected, actual)
+	}
+	if actual.URLHost() != "golang.org" {
+		t.Fatalf("expected golang.org, but got %s", actual.URLHost())
+	}
+}
+
+func TestRequest_JSON(t *testing.T) {
+	expected := newTestCodecRequest(t)
+	data, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("fail to marshal: %v", err)
+	}
+	actual := new(Request)
+	err = json.Unmarshal(data, actual)
+	if err != nil {
+		t.Fatalf("fail to unmarshal: %v", err)
+	}
+	assertSameRequest(t, expected, actual)
+
+	minimal := new(Request)
+	err = json.Unmarshal([]byte(`{"url":"https://golang.org/"}`), minimal)
+	if err != nil || minimal.Method != "GET" || minimal.QueueName != "default" || minimal.Header == nil {
+		t.Fatalf("expected defaults of NewGetRequest, but got %+v and %v", minimal, err)
+	}
+
+	for _, input := range []string{`{"url":"%%"}`, `{"url":"/relative"}`, `{}`} {
+		err = json.Unmarshal([]byte(input), new(Request))
+		if err == nil {
+			t.Fatalf("expected error for %s, but got nil", input)
+		}
+	}
+}
+
+func TestRequest_Binary(t *testing.T) {
+	expected := newTestCodecRequest(t)
+	data, err := expected.MarshalBinary()
+	if err != nil {
+		t.Fatalf("fail to marshal: %v", err)
+	}
+	actual := new(Request)
+	err = actual.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("fail to unmarshal: %v", err)
+	}
+	assertSameRequest(t, expected, actual)
+
+	err = new(Request).UnmarshalBinary(data[:len(data)-3])
+	if err == nil {
+		t.Fatalf("expected error for truncated data, but got nil")
+	}
+}
+
+func TestRequest_Gob(t *testing.T) {
+	expected := newTestCodecRequest(t)
+	buffer := &bytes.Buffer{}
+	err := gob.NewEncoder(buffer).Encode(expected)
+	if err != nil {
+		t.Fatalf("fail to encode: %v", err)
+	}
+	actual := new(Request)
+	err = gob.NewDecoder(buffer).Decode(actual)
+	if err != nil {
+		t.Fatalf("fail to decode: %v", err)
+	}
+	assertSameRequest(t, expected, actual)
+}
+
+func TestRequest_Validate(t *testing.T) {
+	if err := newTestCodecRequest(t).Validate(); err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	for _, rawURL := range []string{"%%", "/relative", ""} {
+		request := &Request{URL: rawURL}
+		if err := request.Validate(); err == nil {
+			t.Fatalf("expected error for %q, but got nil", rawURL)
+		}
+		// encoding fails for the requests that decoding rejects.
+		if _, err := json.Marshal(request); err == nil {
+			t.Fatalf("expected json error for %q, but got nil", rawURL)
+		}
+		if _, err := request.MarshalBinary(); err == nil {
+			t.Fatalf("expected binary error for %q, but got nil", rawURL)
+		}
+		if _, err := (&Response{Request: request}).MarshalBinary(); err == nil {
+			t.Fatalf("expected response error for %q, but got nil", rawURL)
+		}
+	}
+}
+
+func TestRequest_URLHostOfLiteral(t *testing.T) {
+	request := &Request{URL: "https://golang.org/doc/"}
+	if request.URLHost() != "golang.org" {
+		t.Fatalf("expected golang.org, but got %s", request.URLHost())
+	}
+}
+
+func TestResponse_Codec(t *testing.T) {
+	expected := &Response{
+		StatusCode: 200,
+		Headers:    http.Header{"Content-Type": []string{"text/html"}},
+		Body:       []byte("<html></html>"),
+		Request:    newTestCodecRequest(t),
+	}
+
+	data, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("fail to marshal json: %v", err)
+	}
+	fromJSON := new(Response)
+	err = json.Unmarshal(data, fromJSON)
+	if err != nil {
+		t.Fatalf("fail to unmarshal json: %v", err)
+	}
+
+	data, err = expected.MarshalBinary()
+	if err != nil {
+		t.Fatalf("fail to marshal binary: %v", err)
+	}
+	fromBinary := new(Response)
+	err = fromBinary.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("fail to unmarshal binary: %v", err)
+	}
+
+	for _, actual := range []*Response{fromJSON, fromBinary} {
+		if actual.StatusCode != expected.StatusCode ||
+			!reflect.DeepEqual(actual.Headers, expected.Headers) ||
+			!bytes.Equal(actual.Body, expected.Body) {
+			t.Fatalf("expected %+v, but got %+v", expected, actual)
+		}
+		assertSameRequest(t, expected.Request, actual.Request)
+	}
+}
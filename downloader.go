@@ -0,0 +1,71 @@
+package arachne
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DownloaderMiddleware wraps the HTTPClient that fetches requests, like a decorator of http.RoundTripper.
+// Each layer sees the http.Request, calls next and sees the http.Response or the error,
+// so resources can be released with defer. The body of the http.Response has already been read
+// when next returns, and the Request being fetched is given by RequestFromContext.
+type DownloaderMiddleware func(next HTTPClient) HTTPClient
+
+// HTTPClientFunc is an adapter to use a function as HTTPClient.
+type HTTPClientFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f HTTPClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RetryLaterError is returned by DownloaderMiddleware to put the request back to the WorkerQueue
+// to be fetched after Delay, like ActionRetryLater.
+type RetryLaterError struct {
+	Delay time.Duration
+}
+
+func (e *RetryLaterError) Error() string {
+	return fmt.Sprintf("retry after %v", e.Delay)
+}
+
+type requestContextKey struct{}
+
+// RequestFromContext returns the Request being fetched by the http.Request of ctx.
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	request, ok := ctx.Value(requestContextKey{}).(*Request)
+	return request, ok
+}
+
+// ChainDownloaderMiddlewares wraps client with middlewares. The first middleware is the outermost layer.
+// The body of the http.Response is read before it is returned to the middlewares.
+func ChainDownloaderMiddlewares(client HTTPClient, middlewares ...DownloaderMiddleware) HTTPClient {
+	client = bufferBody(client)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		client = middlewares[i](client)
+	}
+	return client
+}
+
+// bufferBody reads the body of the http.Response so that the download is done within the middlewares.
+func bufferBody(client HTTPClient) HTTPClient {
+	return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := client.Do(req)
+		if err != nil || resp.Body == nil {
+			return resp, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to read body of %s: %w", req.URL.String(), err)
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	})
+}
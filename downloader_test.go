@@ -0,0 +1,190 @@
+package arachne
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestChainDownloaderMiddlewares(t *testing.T) {
+	order := make([]string, 0)
+	layer := func(name string) DownloaderMiddleware {
+		return func(next HTTPClient) HTTPClient {
+			return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				resp, err := next.Do(req)
+				order = append(order, name+" "+err.Error())
+				return resp, err
+			})
+		}
+	}
+	client := HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "client")
+		return nil, errors.New("error")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://golang.org/", nil)
+	_, err := ChainDownloaderMiddlewares(client, layer("a"), layer("b")).Do(req)
+	if err == nil {
+		t.Fatalf("expect error, but got nil")
+	}
+
+	expected := []string{"a", "b", "client", "b error", "a error"}
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expect %v, but got %v", expected, order)
+	}
+}
+
+func TestChainDownloaderMiddlewares_BufferBody(t *testing.T) {
+	read := false
+	client := HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Request: req,
+			Body:    ioutil.NopCloser(strings.NewReader("body")),
+		}, nil
+	})
+	layer := func(next HTTPClient) HTTPClient {
+		return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			read = true
+			return resp, err
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://golang.org/", nil)
+	resp, err := ChainDownloaderMiddlewares(client, layer).Do(req)
+	if err != nil {
+		t.Fatalf("fail to do request: %v", err)
+	}
+	if !read {
+		t.Fatalf("expect the layer to see the response")
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "body" {
+		t.Fatalf("expect body, but got %s", body)
+	}
+}
+
+func TestWorker_DownloaderMiddlewares(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Request: r}, nil
+		},
+	).Times(1)
+
+	worker := newWorker(nil, httpClientMock, loggerMock, nil, nil, nil)
+	worker.DownloaderMiddlewares = []DownloaderMiddleware{
+		func(next HTTPClient) HTTPClient {
+			return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				r, ok := RequestFromContext(req.Context())
+				if !ok || r != request {
+					t.Fatalf("expect the request in the context, but got %v", r)
+				}
+				return next.Do(req)
+			})
+		},
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 1 || responses[0].StatusCode != 200 {
+		t.Fatalf("expect a response, but got %v", responses)
+	}
+}
+
+func TestWorker_DownloaderMiddlewaresChainedOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Request: r}, nil
+		},
+	).Times(3)
+
+	chained := 0
+	worker := newWorker(nil, httpClientMock, loggerMock, nil, nil, nil)
+	worker.DownloaderMiddlewares = []DownloaderMiddleware{
+		func(next HTTPClient) HTTPClient {
+			chained++
+			return next
+		},
+	}
+
+	requests := make([]*Request, 0, 3)
+	for _, u := range []string{"https://golang.org/", "https://golang.org/doc/", "https://golang.org/pkg/"} {
+		request, _ := NewGetRequest(u)
+		requests = append(requests, request)
+	}
+	responses := doRequestWithin(t, worker, requests)
+	if len(responses) != 3 {
+		t.Fatalf("expect 3 responses, but got %v", responses)
+	}
+	if chained != 1 {
+		t.Fatalf("expect the middlewares to be chained once, but got %d", chained)
+	}
+}
+
+func TestWorker_DownloaderMiddlewareRetryLater(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).DoAndReturn(
+		func(retryRequest *Request) error {
+			if retryRequest.NotBefore.IsZero() {
+				t.Fatalf("expect NotBefore to be set")
+			}
+			return nil
+		},
+	).Times(1)
+
+	counter := make(pairedCounter, 1)
+	worker := newWorker(
+		workerQueueMock,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){counter.requestMiddleware},
+		[]func(response *Response){counter.responseMiddleware},
+		nil,
+	)
+	worker.DownloaderMiddlewares = []DownloaderMiddleware{
+		func(next HTTPClient) HTTPClient {
+			return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, &RetryLaterError{Delay: time.Second}
+			})
+		},
+	}
+
+	responses := doRequestWithin(t, worker, []*Request{request})
+	if len(responses) != 0 {
+		t.Fatalf("expect no response, but got %v", responses)
+	}
+	// the paired middlewares have released the counter
+	select {
+	case counter <- struct{}{}:
+	default:
+		t.Fatalf("expect the counter to be released")
+	}
+}
@@ -0,0 +1,12 @@
+package arachne
+
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE -self_package=github.com/getumen/arachne
+
+// DupeFilter remembers the requests that have been seen, usually by their Fingerprint.
+type DupeFilter interface {
+	// Seen reports whether a request with the same fingerprint has been recorded.
+	Seen(request *Request) (bool, error)
+	// Record records the request so that Seen reports true for the requests with the same fingerprint.
+	// Callers record a request after storing it so that a request that fails to be stored is not lost.
+	Record(request *Request) error
+}
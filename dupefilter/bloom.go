@@ -0,0 +1,282 @@
+package dupefilter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// bloomMagic and bloomVersion are the header of the persisted Bloom filter.
+	bloomMagic   = "ARBF"
+	bloomVersion = 1
+	// bloomGrowth is the capacity ratio of a new Bloom filter to the previous one.
+	bloomGrowth = 2
+	// bloomTightening is the false positive rate ratio of a new Bloom filter to the previous one.
+	bloomTightening = 0.5
+)
+
+// bloomFilter is a fixed-size Bloom filter.
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64
+	k        uint32
+	capacity uint64
+	count    uint64
+}
+
+func newBloomFilter(capacity uint64, falsePositiveRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint32(math.Ceil(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// locations returns the bit positions of the digest by double hashing.
+func (f *bloomFilter) locations(h1, h2 uint64) func(i uint32) uint64 {
+	return func(i uint32) uint64 {
+		return (h1 + uint64(i)*h2) % f.m
+	}
+}
+
+func (f *bloomFilter) contains(h1, h2 uint64) bool {
+	location := f.locations(h1, h2)
+	for i := uint32(0); i < f.k; i++ {
+		l := location(i)
+		if f.bits[l/64]&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(h1, h2 uint64) {
+	location := f.locations(h1, h2)
+	for i := uint32(0); i < f.k; i++ {
+		l := location(i)
+		f.bits[l/64] |= 1 << (l % 64)
+	}
+	f.count++
+}
+
+// BloomDupeFilter is DupeFilter backed by a scalable Bloom filter.
+// It adds a larger Bloom filter with a smaller false positive rate whenever the last one is full,
+// so that the false positive rate stays below the configured one however many requests it sees.
+// A false positive drops a request that has never been seen.
+type BloomDupeFilter struct {
+	mutex             sync.Mutex
+	falsePositiveRate float64
+	filters           []*bloomFilter
+}
+
+// NewBloomDupeFilter returns BloomDupeFilter whose first Bloom filter holds capacity requests
+// and whose false positive rate is at most falsePositiveRate.
+func NewBloomDupeFilter(capacity int, falsePositiveRate float64) (*BloomDupeFilter, error) {
+	if capacity <= 0 {
+		return nil, xerrors.Errorf("capacity must be positive, but got %d", capacity)
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, xerrors.Errorf("false positive rate must be in (0, 1), but got %v", falsePositiveRate)
+	}
+	return &BloomDupeFilter{
+		falsePositiveRate: falsePositiveRate,
+		filters: []*bloomFilter{
+			newBloomFilter(uint64(capacity), falsePositiveRate*(1-bloomTightening)),
+		},
+	}, nil
+}
+
+// Seen reports whether the fingerprint of the request has probably been recorded.
+func (f *BloomDupeFilter) Seen(request *arachne.Request) (bool, error) {
+	h1, h2, err := bloomHashes(request)
+	if err != nil {
+		return false, err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.contains(h1, h2), nil
+}
+
+// Record records the fingerprint of the request.
+func (f *BloomDupeFilter) Record(request *arachne.Request) error {
+	h1, h2, err := bloomHashes(request)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.contains(h1, h2) {
+		return nil
+	}
+	last := f.filters[len(f.filters)-1]
+	if last.count >= last.capacity {
+		rate := f.falsePositiveRate * (1 - bloomTightening) * math.Pow(bloomTightening, float64(len(f.filters)))
+		last = newBloomFilter(last.capacity*bloomGrowth, rate)
+		f.filters = append(f.filters, last)
+	}
+	last.add(h1, h2)
+	return nil
+}
+
+// contains reports whether any Bloom filter contains the hashes. mutex must be held.
+func (f *BloomDupeFilter) contains(h1, h2 uint64) bool {
+	for _, filter := range f.filters {
+		if filter.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// bloomHashes returns the two hashes of the fingerprint of the request for double hashing.
+func bloomHashes(request *arachne.Request) (uint64, uint64, error) {
+	digest, err := decodeFingerprint(arachne.Fingerprint(request))
+	if err != nil {
+		return 0, 0, xerrors.Errorf("fail to decode fingerprint of %s: %w", request.URL, err)
+	}
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1, nil
+}
+
+// WriteTo writes the Bloom filters to w.
+func (f *BloomDupeFilter) WriteTo(w io.Writer) (int64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	writer := &countingWriter{writer: w}
+	buffered := bufio.NewWriter(writer)
+	header := []interface{}{
+		[]byte(bloomMagic),
+		uint32(bloomVersion),
+		f.falsePositiveRate,
+		uint32(len(f.filters)),
+	}
+	for _, field := range header {
+		err := binary.Write(buffered, binary.BigEndian, field)
+		if err != nil {
+			return writer.n, xerrors.Errorf("fail to write bloom filter header: %w", err)
+		}
+	}
+	for _, filter := range f.filters {
+		for _, field := range []interface{}{filter.m, filter.k, filter.capacity, filter.count, filter.bits} {
+			err := binary.Write(buffered, binary.BigEndian, field)
+			if err != nil {
+				return writer.n, xerrors.Errorf("fail to write bloom filter: %w", err)
+			}
+		}
+	}
+	err := buffered.Flush()
+	if err != nil {
+		return writer.n, xerrors.Errorf("fail to write bloom filter: %w", err)
+	}
+	return writer.n, nil
+}
+
+// ReadBloomDupeFilter reads BloomDupeFilter written by BloomDupeFilter.WriteTo.
+func ReadBloomDupeFilter(r io.Reader) (*BloomDupeFilter, error) {
+	reader := bufio.NewReader(r)
+	magic := make([]byte, len(bloomMagic))
+	var version, num uint32
+	f := &BloomDupeFilter{}
+	for _, field := range []interface{}{magic, &version, &f.falsePositiveRate, &num} {
+		err := binary.Read(reader, binary.BigEndian, field)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to read bloom filter header: %w", err)
+		}
+	}
+	if string(magic) != bloomMagic || version != bloomVersion {
+		return nil, xerrors.Errorf("unknown bloom filter format %q version %d", magic, version)
+	}
+	if num == 0 {
+		return nil, xerrors.New("bloom filter has no filter")
+	}
+	for i := uint32(0); i < num; i++ {
+		filter := &bloomFilter{}
+		for _, field := range []interface{}{&filter.m, &filter.k, &filter.capacity, &filter.count} {
+			err := binary.Read(reader, binary.BigEndian, field)
+			if err != nil {
+				return nil, xerrors.Errorf("fail to read bloom filter: %w", err)
+			}
+		}
+		if filter.m == 0 || filter.k == 0 {
+			return nil, xerrors.New("bloom filter is broken")
+		}
+		filter.bits = make([]uint64, (filter.m+63)/64)
+		err := binary.Read(reader, binary.BigEndian, filter.bits)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to read bloom filter: %w", err)
+		}
+		f.filters = append(f.filters, filter)
+	}
+	return f, nil
+}
+
+// Save writes the Bloom filters to the file at path atomically.
+func (f *BloomDupeFilter) Save(path string) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return xerrors.Errorf("fail to create %s: %w", tmpPath, err)
+	}
+	_, err = f.WriteTo(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return xerrors.Errorf("fail to save bloom filter to %s: %w", path, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return xerrors.Errorf("fail to close %s: %w", tmpPath, err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return xerrors.Errorf("fail to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadBloomDupeFilter reads BloomDupeFilter saved by BloomDupeFilter.Save.
+// If the file does not exist, it returns a new BloomDupeFilter with capacity and falsePositiveRate.
+func LoadBloomDupeFilter(path string, capacity int, falsePositiveRate float64) (*BloomDupeFilter, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return NewBloomDupeFilter(capacity, falsePositiveRate)
+	} else if err != nil {
+		return nil, xerrors.Errorf("fail to open %s: %w", path, err)
+	}
+	defer file.Close()
+	f, err := ReadBloomDupeFilter(file)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to load bloom filter from %s: %w", path, err)
+	}
+	return f, nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+package dupefilter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getumen/arachne"
+)
+
+func TestBloomDupeFilter_FalsePositiveRate(t *testing.T) {
+	filter, err := NewBloomDupeFilter(1000, 0.01)
+	if err != nil {
+		t.Fatalf("fail to create bloom filter: %v", err)
+	}
+	num := 10000
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		filter.Record(r)
+	}
+	if len(filter.filters) < 2 {
+		t.Fatalf("expected the filter to grow, but got %d filters", len(filter.filters))
+	}
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		if seen, _ := filter.Seen(r); !seen {
+			t.Fatalf("expected %s to be seen", r.URL)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/unseen/%d", i))
+		if seen, _ := filter.Seen(r); seen {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / float64(num); rate > 0.02 {
+		t.Fatalf("expected false positive rate about 0.01, but got %v", rate)
+	}
+}
+
+func TestBloomDupeFilter_SaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dupefilter")
+	if err != nil {
+		t.Fatalf("fail to create temp dir")
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bloom")
+
+	filter, err := LoadBloomDupeFilter(path, 10, 0.01)
+	if err != nil {
+		t.Fatalf("fail to create bloom filter: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		filter.Record(r)
+	}
+	err = filter.Save(path)
+	if err != nil {
+		t.Fatalf("fail to save bloom filter: %v", err)
+	}
+
+	loaded, err := LoadBloomDupeFilter(path, 10, 0.01)
+	if err != nil {
+		t.Fatalf("fail to load bloom filter: %v", err)
+	}
+	if len(loaded.filters) != len(filter.filters) {
+		t.Fatalf("expected %d filters, but got %d", len(filter.filters), len(loaded.filters))
+	}
+	for i := 0; i < 100; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		if seen, _ := loaded.Seen(r); !seen {
+			t.Fatalf("expected %s to be seen after load", r.URL)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package dupefilter
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// DiskDupeFilter is DupeFilter that appends fingerprints to a file so that the seen requests survive restarts.
+// The set is loaded from the file on open and kept in memory as raw SHA-1 digests.
+type DiskDupeFilter struct {
+	mutex        sync.Mutex
+	file         *os.File
+	writer       *bufio.Writer
+	fingerprints map[[sha1.Size]byte]struct{}
+}
+
+// NewDiskDupeFilter opens or creates the fingerprint file at path and loads its fingerprints.
+func NewDiskDupeFilter(path string) (*DiskDupeFilter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to open %s: %w", path, err)
+	}
+	f := &DiskDupeFilter{
+		file:         file,
+		fingerprints: map[[sha1.Size]byte]struct{}{},
+	}
+	err = f.load()
+	if err != nil {
+		file.Close()
+		return nil, xerrors.Errorf("fail to load %s: %w", path, err)
+	}
+	f.writer = bufio.NewWriter(file)
+	return f, nil
+}
+
+func (f *DiskDupeFilter) load() error {
+	reader := bufio.NewReader(f.file)
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// a partial line is the trace of a crash while writing it.
+			break
+		} else if err != nil {
+			return xerrors.Errorf("fail to read fingerprints: %w", err)
+		}
+		digest, err := decodeFingerprint(line[:len(line)-1])
+		if err != nil {
+			return xerrors.Errorf("fingerprint is broken at offset %d: %w", offset, err)
+		}
+		f.fingerprints[digest] = struct{}{}
+		offset += int64(len(line))
+	}
+	err := f.file.Truncate(offset)
+	if err != nil {
+		return xerrors.Errorf("fail to truncate fingerprints: %w", err)
+	}
+	_, err = f.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return xerrors.Errorf("fail to seek fingerprints: %w", err)
+	}
+	return nil
+}
+
+// Seen reports whether the fingerprint of the request has been recorded.
+func (f *DiskDupeFilter) Seen(request *arachne.Request) (bool, error) {
+	digest, err := decodeFingerprint(arachne.Fingerprint(request))
+	if err != nil {
+		return false, xerrors.Errorf("fail to decode fingerprint of %s: %w", request.URL, err)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, ok := f.fingerprints[digest]
+	return ok, nil
+}
+
+// Record records the fingerprint of the request.
+// Recorded fingerprints are buffered until Flush or Close.
+func (f *DiskDupeFilter) Record(request *arachne.Request) error {
+	fingerprint := arachne.Fingerprint(request)
+	digest, err := decodeFingerprint(fingerprint)
+	if err != nil {
+		return xerrors.Errorf("fail to decode fingerprint of %s: %w", request.URL, err)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.fingerprints[digest]; ok {
+		return nil
+	}
+	if f.writer == nil {
+		return xerrors.New("dupe filter is closed")
+	}
+	_, err = f.writer.WriteString(fingerprint + "\n")
+	if err != nil {
+		return xerrors.Errorf("fail to write fingerprint of %s: %w", request.URL, err)
+	}
+	f.fingerprints[digest] = struct{}{}
+	return nil
+}
+
+// Flush writes the buffered fingerprints to the file.
+func (f *DiskDupeFilter) Flush() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.writer == nil {
+		return xerrors.New("dupe filter is closed")
+	}
+	err := f.writer.Flush()
+	if err != nil {
+		return xerrors.Errorf("fail to flush fingerprints: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the fingerprints to the disk and closes the file.
+func (f *DiskDupeFilter) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.writer == nil {
+		return nil
+	}
+	err := f.writer.Flush()
+	if err == nil {
+		err = f.file.Sync()
+	}
+	f.writer = nil
+	if err != nil {
+		f.file.Close()
+		return xerrors.Errorf("fail to flush fingerprints: %w", err)
+	}
+	err = f.file.Close()
+	if err != nil {
+		return xerrors.Errorf("fail to close fingerprints: %w", err)
+	}
+	return nil
+}
+
+func decodeFingerprint(fingerprint string) ([sha1.Size]byte, error) {
+	var digest [sha1.Size]byte
+	if hex.DecodedLen(len(fingerprint)) != sha1.Size {
+		return digest, xerrors.Errorf("fingerprint %q is not a SHA-1 digest", fingerprint)
+	}
+	_, err := hex.Decode(digest[:], []byte(fingerprint))
+	if err != nil {
+		return digest, xerrors.Errorf("fingerprint %q is not a SHA-1 digest: %w", fingerprint, err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,60 @@
+package dupefilter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getumen/arachne"
+)
+
+func TestDiskDupeFilter_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dupefilter")
+	if err != nil {
+		t.Fatalf("fail to create temp dir")
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fingerprints")
+
+	filter, err := NewDiskDupeFilter(path)
+	if err != nil {
+		t.Fatalf("fail to open dupe filter: %v", err)
+	}
+	a, _ := arachne.NewGetRequest("https://golang.org/a")
+	b, _ := arachne.NewGetRequest("https://golang.org/b")
+	seen, err := filter.Seen(a)
+	if err != nil || seen {
+		t.Fatalf("expected an unseen request, but got %v, %v", seen, err)
+	}
+	err = filter.Record(a)
+	if err != nil {
+		t.Fatalf("fail to record: %v", err)
+	}
+	err = filter.Close()
+	if err != nil {
+		t.Fatalf("fail to close dupe filter: %v", err)
+	}
+
+	// a partial line is dropped on restore.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("fail to open fingerprints")
+	}
+	file.WriteString(arachne.Fingerprint(b)[:10])
+	file.Close()
+
+	filter, err = NewDiskDupeFilter(path)
+	if err != nil {
+		t.Fatalf("fail to reopen dupe filter: %v", err)
+	}
+	defer filter.Close()
+	seen, err = filter.Seen(a)
+	if err != nil || !seen {
+		t.Fatalf("expected a seen request, but got %v, %v", seen, err)
+	}
+	seen, err = filter.Seen(b)
+	if err != nil || seen {
+		t.Fatalf("expected an unseen request, but got %v, %v", seen, err)
+	}
+}
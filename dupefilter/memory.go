@@ -0,0 +1,33 @@
+package dupefilter
+
+import (
+	"sync"
+
+	"github.com/getumen/arachne"
+)
+
+type memoryDupeFilter struct {
+	mutex        sync.Mutex
+	fingerprints map[string]struct{}
+}
+
+// NewMemoryDupeFilter returns DupeFilter that keeps the exact set of fingerprints in memory.
+func NewMemoryDupeFilter() arachne.DupeFilter {
+	return &memoryDupeFilter{fingerprints: map[string]struct{}{}}
+}
+
+func (f *memoryDupeFilter) Seen(request *arachne.Request) (bool, error) {
+	fingerprint := arachne.Fingerprint(request)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, ok := f.fingerprints[fingerprint]
+	return ok, nil
+}
+
+func (f *memoryDupeFilter) Record(request *arachne.Request) error {
+	fingerprint := arachne.Fingerprint(request)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.fingerprints[fingerprint] = struct{}{}
+	return nil
+}
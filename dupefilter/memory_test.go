@@ -0,0 +1,30 @@
+package dupefilter
+
+import (
+	"testing"
+
+	"github.com/getumen/arachne"
+)
+
+func TestMemoryDupeFilter_Seen(t *testing.T) {
+	filter := NewMemoryDupeFilter()
+	a, _ := arachne.NewGetRequest("http://a.com/x?b=1&a=2")
+	b, _ := arachne.NewGetRequest("http://A.com/x?a=2&b=1#frag")
+
+	seen, err := filter.Seen(a)
+	if err != nil || seen {
+		t.Fatalf("expected an unseen request, but got %v, %v", seen, err)
+	}
+	seen, err = filter.Seen(b)
+	if err != nil || seen {
+		t.Fatalf("expected Seen not to record the request, but got %v, %v", seen, err)
+	}
+	err = filter.Record(a)
+	if err != nil {
+		t.Fatalf("fail to record: %v", err)
+	}
+	seen, err = filter.Seen(b)
+	if err != nil || !seen {
+		t.Fatalf("expected a seen request, but got %v, %v", seen, err)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/getumen/arachne"
 	"github.com/getumen/arachne/builder"
 	"github.com/getumen/arachne/logger"
+	"github.com/getumen/arachne/middlewares/ratelimit"
 	"github.com/getumen/arachne/middlewares/resource"
+	"github.com/getumen/arachne/middlewares/robots"
 	"github.com/getumen/arachne/queue"
 	"github.com/getumen/arachne/spider"
 )
@@ -46,6 +48,11 @@ func TestSimpleCrawler(t *testing.T) {
 
 	worker.RequestMiddlewares = append(worker.RequestMiddlewares, worker.RetryMiddleware)
 
+	robotsMiddleware := robots.NewMiddleware(httpClient, "arachne", 24*time.Hour)
+	worker.Middlewares = append(worker.Middlewares, robotsMiddleware)
+	rateLimiter := ratelimit.NewLimiter(1, 1).SetCrawlDelay(robotsMiddleware.CrawlDelay)
+	worker.Middlewares = append(worker.Middlewares, rateLimiter)
+
 	ctx := context.Background()
 
 	ctx, cancelFunc := context.WithCancel(ctx)
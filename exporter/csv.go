@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/getumen/arachne"
+)
+
+// NewCSVExporter creates Exporter that writes items as CSV rows with a header row in each file.
+// The columns are fields, or the sorted keys of the first item if fields is empty.
+// Keys that are not columns are ignored, and missing keys are written as empty cells.
+// Values other than strings, numbers and booleans are written as JSON.
+func NewCSVExporter(dir, prefix string, fields []string, options ...Option) *Exporter {
+	return newExporter(dir, prefix, &csvFormat{fields: fields}, options...)
+}
+
+type csvFormat struct {
+	fields []string
+	// pending is true when the header of the current file is not written yet.
+	pending bool
+}
+
+func (f *csvFormat) extension() string {
+	return "csv"
+}
+
+func (f *csvFormat) begin(w io.Writer) error {
+	// the header is written with the first item because it may depend on the item.
+	f.pending = true
+	return nil
+}
+
+func (f *csvFormat) encode(w io.Writer, item arachne.Item) error {
+	writer := csv.NewWriter(w)
+	if f.fields == nil {
+		f.fields = make([]string, 0, len(item))
+		for key := range item {
+			f.fields = append(f.fields, key)
+		}
+		sort.Strings(f.fields)
+	}
+	if f.pending {
+		err := writer.Write(f.fields)
+		if err != nil {
+			return err
+		}
+		f.pending = false
+	}
+	record := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		value, ok := item[field]
+		if !ok || value == nil {
+			continue
+		}
+		cell, err := csvCell(value)
+		if err != nil {
+			return err
+		}
+		record[i] = cell
+	}
+	err := writer.Write(record)
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (f *csvFormat) end(w io.Writer) error {
+	return nil
+}
+
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,212 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// format writes items in a file format.
+type format interface {
+	extension() string
+	begin(w io.Writer) error
+	encode(w io.Writer, item arachne.Item) error
+	end(w io.Writer) error
+}
+
+// Option configures Exporter.
+type Option func(e *Exporter)
+
+// WithMaxBytes rotates the file once it has maxBytes bytes or more.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(e *Exporter) {
+		e.maxBytes = maxBytes
+	}
+}
+
+// WithMaxItems rotates the file once it has maxItems items.
+func WithMaxItems(maxItems int) Option {
+	return func(e *Exporter) {
+		e.maxItems = maxItems
+	}
+}
+
+// WithMaxAge rotates the file when an item is exported maxAge after the file is opened.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(e *Exporter) {
+		e.maxAge = maxAge
+	}
+}
+
+// Exporter writes items to files in dir named "<prefix>-<opened time>-<sequence>.<extension>".
+// A file is written as a temporary file with ".tmp" suffix and renamed when it is rotated or closed,
+// so that readers never see a partial file.
+// Exporter is an arachne.ItemPipeline that passes items through, and it must be closed to flush the last file.
+type Exporter struct {
+	mutex    sync.Mutex
+	dir      string
+	prefix   string
+	format   format
+	maxBytes int64
+	maxItems int
+	maxAge   time.Duration
+	now      func() time.Time
+
+	file     *os.File
+	writer   *bufio.Writer
+	counter  *countingWriter
+	path     string
+	openedAt time.Time
+	items    int
+	sequence int
+	err      error
+}
+
+func newExporter(dir, prefix string, f format, options ...Option) *Exporter {
+	e := &Exporter{
+		dir:    dir,
+		prefix: prefix,
+		format: f,
+		now:    time.Now,
+	}
+	for _, option := range options {
+		option(e)
+	}
+	return e
+}
+
+// ProcessItem exports the item and returns it as it is.
+func (e *Exporter) ProcessItem(item arachne.Item, _ *arachne.Response) (arachne.Item, error) {
+	err := e.Export(item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Export writes the item to the current file, and rotates the file if it reaches a limit.
+func (e *Exporter) Export(item arachne.Item) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	if e.file != nil && e.maxAge > 0 && e.now().Sub(e.openedAt) >= e.maxAge {
+		err := e.finish()
+		if err != nil {
+			return e.fail(err)
+		}
+	}
+	if e.file == nil {
+		err := e.open()
+		if err != nil {
+			return e.fail(err)
+		}
+	}
+	err := e.format.encode(e.writer, item)
+	if err != nil {
+		return xerrors.Errorf("fail to export item to %s: %w", e.path, err)
+	}
+	e.items++
+	if (e.maxItems > 0 && e.items >= e.maxItems) || (e.maxBytes > 0 && e.size() >= e.maxBytes) {
+		err = e.finish()
+		if err != nil {
+			return e.fail(err)
+		}
+	}
+	return nil
+}
+
+// Close finishes the current file.
+func (e *Exporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.file == nil {
+		return e.err
+	}
+	err := e.finish()
+	if err != nil {
+		return e.fail(err)
+	}
+	return e.err
+}
+
+// fail keeps the error of the file so that items are not exported to a broken file.
+func (e *Exporter) fail(err error) error {
+	if e.file != nil {
+		e.file.Close()
+		os.Remove(e.path + ".tmp")
+		e.file = nil
+	}
+	e.err = err
+	return err
+}
+
+func (e *Exporter) size() int64 {
+	return e.counter.n + int64(e.writer.Buffered())
+}
+
+func (e *Exporter) open() error {
+	e.openedAt = e.now()
+	e.sequence++
+	name := fmt.Sprintf("%s-%s-%06d.%s",
+		e.prefix, e.openedAt.UTC().Format("20060102T150405Z"), e.sequence, e.format.extension())
+	e.path = filepath.Join(e.dir, name)
+	file, err := os.OpenFile(e.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return xerrors.Errorf("fail to create %s: %w", e.path+".tmp", err)
+	}
+	e.file = file
+	e.counter = &countingWriter{writer: file}
+	e.writer = bufio.NewWriter(e.counter)
+	e.items = 0
+	err = e.format.begin(e.writer)
+	if err != nil {
+		return xerrors.Errorf("fail to begin %s: %w", e.path, err)
+	}
+	return nil
+}
+
+// finish writes the end of the file and renames the temporary file.
+func (e *Exporter) finish() error {
+	err := e.format.end(e.writer)
+	if err != nil {
+		return xerrors.Errorf("fail to end %s: %w", e.path, err)
+	}
+	err = e.writer.Flush()
+	if err == nil {
+		err = e.file.Sync()
+	}
+	if err != nil {
+		return xerrors.Errorf("fail to flush %s: %w", e.path, err)
+	}
+	err = e.file.Close()
+	e.file = nil
+	if err != nil {
+		os.Remove(e.path + ".tmp")
+		return xerrors.Errorf("fail to close %s: %w", e.path, err)
+	}
+	err = os.Rename(e.path+".tmp", e.path)
+	if err != nil {
+		return xerrors.Errorf("fail to rename %s: %w", e.path, err)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func setupTestExporter(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "exporter")
+	if err != nil {
+		t.Fatalf("fail to create temp dir")
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func exportedFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("fail to list files")
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestJSONLExporter_RotateByItems(t *testing.T) {
+	dir, tearDown := setupTestExporter(t)
+	defer tearDown()
+
+	e := NewJSONLExporter(dir, "items", WithMaxItems(2))
+	for i := 0; i < 5; i++ {
+		_, err := e.ProcessItem(arachne.Item{"index": i}, nil)
+		if err != nil {
+			t.Fatalf("fail to export: %v", err)
+		}
+	}
+	files := exportedFiles(t, dir)
+	if len(files) != 3 || !strings.HasSuffix(files[2], ".tmp") {
+		t.Fatalf("expected 2 files and a temporary file, but got %v", files)
+	}
+
+	err := e.Close()
+	if err != nil {
+		t.Fatalf("fail to close: %v", err)
+	}
+	files = exportedFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, but got %v", files)
+	}
+	index := 0
+	for i, file := range files {
+		if !strings.HasSuffix(file, ".jsonl") {
+			t.Fatalf("unexpected file %s", file)
+		}
+		data, _ := ioutil.ReadFile(file)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if expected := []int{2, 2, 1}[i]; len(lines) != expected {
+			t.Fatalf("expected %d lines in %s, but got %d", expected, file, len(lines))
+		}
+		for _, line := range lines {
+			item := arachne.Item{}
+			err := json.Unmarshal([]byte(line), &item)
+			if err != nil || item["index"] != float64(index) {
+				t.Fatalf("expected index %d, but got %s", index, line)
+			}
+			index++
+		}
+	}
+}
+
+func TestCSVExporter_Header(t *testing.T) {
+	dir, tearDown := setupTestExporter(t)
+	defer tearDown()
+
+	e := NewCSVExporter(dir, "items", nil, WithMaxBytes(1))
+	e.Export(arachne.Item{"title": "Go, the language", "rank": 1, "tags": []string{"a"}})
+	e.Export(arachne.Item{"title": "Gopher", "extra": true})
+	e.Close()
+
+	files := exportedFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, but got %v", files)
+	}
+	expected := [][][]string{
+		{{"rank", "tags", "title"}, {"1", "[\"a\"]", "Go, the language"}},
+		{{"rank", "tags", "title"}, {"", "", "Gopher"}},
+	}
+	for i, file := range files {
+		f, _ := os.Open(file)
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("fail to read %s: %v", file, err)
+		}
+		for j, record := range records {
+			if strings.Join(record, "|") != strings.Join(expected[i][j], "|") {
+				t.Fatalf("expected %v, but got %v", expected[i][j], record)
+			}
+		}
+	}
+}
+
+func TestXMLExporter_RotateByAge(t *testing.T) {
+	dir, tearDown := setupTestExporter(t)
+	defer tearDown()
+
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	e := NewXMLExporter(dir, "items", WithMaxAge(time.Minute))
+	e.now = func() time.Time { return now }
+	e.Export(arachne.Item{"title": "<Go>", "tags": []string{"a", "b"}, "1st": "x"})
+	now = now.Add(30 * time.Second)
+	e.Export(arachne.Item{"title": "Gopher"})
+	now = now.Add(time.Minute)
+	e.Export(arachne.Item{"title": "Later"})
+	e.Close()
+
+	files := exportedFiles(t, dir)
+	if len(files) != 2 || filepath.Base(files[0]) != "items-20190701T000000Z-000001.xml" {
+		t.Fatalf("unexpected files %v", files)
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	parsed := struct {
+		Items []struct {
+			Title string   `xml:"title"`
+			Tags  []string `xml:"tags>value"`
+		} `xml:"item"`
+	}{}
+	err := xml.Unmarshal(data, &parsed)
+	if err != nil {
+		t.Fatalf("fail to parse %s: %v", data, err)
+	}
+	if len(parsed.Items) != 2 || parsed.Items[0].Title != "<Go>" || len(parsed.Items[0].Tags) != 2 {
+		t.Fatalf("unexpected items %+v", parsed.Items)
+	}
+}
@@ -0,0 +1,31 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/getumen/arachne"
+)
+
+// NewJSONLExporter creates Exporter that writes an item as a JSON object per line.
+func NewJSONLExporter(dir, prefix string, options ...Option) *Exporter {
+	return newExporter(dir, prefix, jsonlFormat{}, options...)
+}
+
+type jsonlFormat struct{}
+
+func (jsonlFormat) extension() string {
+	return "jsonl"
+}
+
+func (jsonlFormat) begin(w io.Writer) error {
+	return nil
+}
+
+func (jsonlFormat) encode(w io.Writer, item arachne.Item) error {
+	return json.NewEncoder(w).Encode(item)
+}
+
+func (jsonlFormat) end(w io.Writer) error {
+	return nil
+}
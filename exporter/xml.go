@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/getumen/arachne"
+)
+
+// NewXMLExporter creates Exporter that writes items as <item> elements in an <items> element.
+// Each key of an item becomes a child element in the order of key, slices become <value> elements,
+// and maps become nested elements. Characters that are not allowed in element names are replaced with "_".
+func NewXMLExporter(dir, prefix string, options ...Option) *Exporter {
+	return newExporter(dir, prefix, xmlFormat{}, options...)
+}
+
+type xmlFormat struct{}
+
+func (xmlFormat) extension() string {
+	return "xml"
+}
+
+func (xmlFormat) begin(w io.Writer) error {
+	_, err := io.WriteString(w, xml.Header+"<items>\n")
+	return err
+}
+
+func (xmlFormat) encode(w io.Writer, item arachne.Item) error {
+	builder := &strings.Builder{}
+	builder.WriteString("  <item>")
+	err := writeXMLMap(builder, item)
+	if err != nil {
+		return err
+	}
+	builder.WriteString("</item>\n")
+	_, err = io.WriteString(w, builder.String())
+	return err
+}
+
+func (xmlFormat) end(w io.Writer) error {
+	_, err := io.WriteString(w, "</items>\n")
+	return err
+}
+
+func writeXMLMap(builder *strings.Builder, m map[string]interface{}) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := writeXMLElement(builder, xmlName(key), m[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeXMLElement(builder *strings.Builder, name string, value interface{}) error {
+	builder.WriteString("<" + name + ">")
+	err := writeXMLValue(builder, value)
+	if err != nil {
+		return err
+	}
+	builder.WriteString("</" + name + ">")
+	return nil
+}
+
+func writeXMLValue(builder *strings.Builder, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case arachne.Item:
+		return writeXMLMap(builder, v)
+	case map[string]interface{}:
+		return writeXMLMap(builder, v)
+	case []byte:
+		return xml.EscapeText(builder, v)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			err := writeXMLElement(builder, "value", rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return xml.EscapeText(builder, []byte(fmt.Sprint(value)))
+}
+
+// xmlName makes the key a valid XML element name.
+func xmlName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		valid := unicode.IsLetter(r) || r == '_' ||
+			(i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'))
+		if !valid {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
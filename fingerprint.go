@@ -0,0 +1,99 @@
+package arachne
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns the hex-encoded SHA-1 of the method, the canonical url and the body of the request.
+// Requests with the same fingerprint are regarded as the same request.
+// A url that cannot be canonicalized is used as it is.
+func Fingerprint(request *Request) string {
+	canonicalURL, err := CanonicalizeURL(request.URL)
+	if err != nil {
+		canonicalURL = request.URL
+	}
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	hash := sha1.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(canonicalURL))
+	hash.Write([]byte{0})
+	hash.Write(request.Body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CanonicalizeURL normalizes the url so that urls that point to the same resource become the same string.
+// It lowercases the scheme and the host, drops the default port and the fragment,
+// and sorts the query parameters by key and value.
+func CanonicalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = canonicalHost(u.Scheme, u.Host)
+	u.Fragment = ""
+	if u.Path == "" && u.Opaque == "" && u.Host != "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	u.RawQuery = canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+func canonicalHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return host
+}
+
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.FieldsFunc(rawQuery, func(r rune) bool {
+		return r == '&' || r == ';'
+	})
+	for i, pair := range pairs {
+		key := pair
+		value := ""
+		hasValue := false
+		if j := strings.Index(pair, "="); j >= 0 {
+			key, value, hasValue = pair[:j], pair[j+1:], true
+		}
+		pairs[i] = canonicalQueryComponent(key)
+		if hasValue {
+			pairs[i] += "=" + canonicalQueryComponent(value)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// canonicalQueryComponent re-escapes the query component so that equivalent escapes become the same.
+// A component with an invalid escape is kept as it is.
+func canonicalQueryComponent(component string) string {
+	unescaped, err := url.QueryUnescape(component)
+	if err != nil {
+		return component
+	}
+	return url.QueryEscape(unescaped)
+}
@@ -0,0 +1,57 @@
+package arachne
+
+import (
+	"testing"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://a.com/x?b=1&a=2", "http://a.com/x?a=2&b=1"},
+		{"http://A.com/x?a=2&b=1#frag", "http://a.com/x?a=2&b=1"},
+		{"HTTPS://a.com:443", "https://a.com/"},
+		{"http://a.com:8080/x", "http://a.com:8080/x"},
+		{"http://a.com/x?q=a%20b&q=a+a", "http://a.com/x?q=a+a&q=a+b"},
+		{"http://a.com/x?", "http://a.com/x"},
+	}
+
+	for i, tt := range tests {
+		actual, err := CanonicalizeURL(tt.url)
+		if err != nil {
+			t.Fatalf("test case %d: fail to canonicalize %s: %v", i, tt.url, err)
+		}
+		if actual != tt.expected {
+			t.Fatalf("test case %d: expected %s, but got %s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	newRequest := func(method, url, body string) *Request {
+		request, err := NewGetRequest(url)
+		if err != nil {
+			t.Fatalf("fail to create request")
+		}
+		request.Method = method
+		request.Body = []byte(body)
+		return request
+	}
+
+	tests := []struct {
+		a, b     *Request
+		expected bool
+	}{
+		{newRequest("GET", "http://a.com/x?b=1&a=2", ""), newRequest("GET", "http://A.com/x?a=2&b=1#frag", ""), true},
+		{newRequest("get", "http://a.com/x", ""), newRequest("GET", "http://a.com/x", ""), true},
+		{newRequest("POST", "http://a.com/x", "a=1"), newRequest("POST", "http://a.com/x", "a=2"), false},
+		{newRequest("GET", "http://a.com/x", ""), newRequest("POST", "http://a.com/x", ""), false},
+	}
+
+	for i, tt := range tests {
+		if actual := Fingerprint(tt.a) == Fingerprint(tt.b); actual != tt.expected {
+			t.Fatalf("test case %d: expected same fingerprint %v, but got %v", i, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package arachne
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// ErrDropItem is returned by ItemPipeline to drop the item without error logs.
+var ErrDropItem = xerrors.New("drop item")
+
+// Item is a structured data extracted by a spider.
+type Item map[string]interface{}
+
+// SpiderOutput is the output of ItemSpider.
+type SpiderOutput struct {
+	Requests []*Request
+	Items    []Item
+}
+
+// ItemSpider extracts the next requests and items from the response.
+type ItemSpider func(response *Response) (*SpiderOutput, error)
+
+// ItemPipeline is a stage that processes items extracted by ItemSpider, such as validation, transformation and storage.
+type ItemPipeline interface {
+	// ProcessItem returns the item passed to the next stage.
+	// It returns ErrDropItem to drop the item, or another error to drop the item with an error log.
+	ProcessItem(item Item, response *Response) (Item, error)
+}
+
+// ItemPipelineFunc is an adapter to use a function as ItemPipeline.
+type ItemPipelineFunc func(item Item, response *Response) (Item, error)
+
+// ProcessItem calls f(item, response).
+func (f ItemPipelineFunc) ProcessItem(item Item, response *Response) (Item, error) {
+	return f(item, response)
+}
@@ -0,0 +1,98 @@
+package arachne
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+// ReadRequestsJSONL reads requests from JSON Lines, one JSON object per line in the format of Request.MarshalJSON.
+// Empty lines are skipped.
+func ReadRequestsJSONL(r io.Reader) ([]*Request, error) {
+	requests := make([]*Request, 0)
+	err := scanRequestsJSONL(r, func(request *Request) error {
+		requests = append(requests, request)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("fail to read requests: %w", err)
+	}
+	return requests, nil
+}
+
+// WriteRequestsJSONL writes requests as JSON Lines that ReadRequestsJSONL reads.
+func WriteRequestsJSONL(w io.Writer, requests []*Request) error {
+	encoder := json.NewEncoder(w)
+	for _, request := range requests {
+		err := encoder.Encode(request)
+		if err != nil {
+			return xerrors.Errorf("fail to write request %s: %w", request.URL, err)
+		}
+	}
+	return nil
+}
+
+// PublishRequestsJSONL publishes the requests read from JSON Lines to the queue one by one,
+// and returns the number of published requests.
+func PublishRequestsJSONL(r io.Reader, queue WorkerQueue) (int, error) {
+	published := 0
+	err := scanRequestsJSONL(r, func(request *Request) error {
+		err := queue.PublishRequest(request)
+		if err != nil {
+			return xerrors.Errorf("fail to publish request %s: %w", request.URL, err)
+		}
+		published++
+		return nil
+	})
+	if err != nil {
+		return published, xerrors.Errorf("fail to publish requests: %w", err)
+	}
+	return published, nil
+}
+
+// DumpRequestsJSONL writes the pending requests of the queue as JSON Lines,
+// and returns the number of written requests. The queue must implement InspectableWorkerQueue.
+func DumpRequestsJSONL(w io.Writer, queue WorkerQueue) (int, error) {
+	inspectable, ok := queue.(InspectableWorkerQueue)
+	if !ok {
+		return 0, xerrors.New("worker queue cannot list pending requests")
+	}
+	requests, err := inspectable.PendingRequests()
+	if err != nil {
+		return 0, xerrors.Errorf("fail to list pending requests: %w", err)
+	}
+	err = WriteRequestsJSONL(w, requests)
+	if err != nil {
+		return 0, xerrors.Errorf("fail to dump requests: %w", err)
+	}
+	return len(requests), nil
+}
+
+func scanRequestsJSONL(r io.Reader, f func(request *Request) error) error {
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return xerrors.Errorf("fail to read line %d: %w", lineNumber, err)
+		}
+		eof := err == io.EOF
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			request := new(Request)
+			err = json.Unmarshal(line, request)
+			if err != nil {
+				return xerrors.Errorf("line %d is invalid: %w", lineNumber, err)
+			}
+			err = f(request)
+			if err != nil {
+				return err
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
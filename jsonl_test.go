@@ -0,0 +1,109 @@
+package arachne
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestWriteRequestsJSONL(t *testing.T) {
+	request, err := NewGetRequest("https://golang.org/search")
+	if err != nil {
+		t.Fatalf("fail to create request")
+	}
+	request.Method = "POST"
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Body = []byte("q=arachne")
+	request.Priority = 3
+	request.QueueName = "search"
+	request.Meta["page"] = "1"
+	seed, _ := NewGetRequest("https://golang.org/")
+
+	buffer := &bytes.Buffer{}
+	err = WriteRequestsJSONL(buffer, []*Request{request, seed})
+	if err != nil {
+		t.Fatalf("fail to write requests: %v", err)
+	}
+	if lines := strings.Count(buffer.String(), "\n"); lines != 2 {
+		t.Fatalf("expected 2 lines, but got %d", lines)
+	}
+
+	requests, err := ReadRequestsJSONL(buffer)
+	if err != nil {
+		t.Fatalf("fail to read requests: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, but got %d", len(requests))
+	}
+	for i, expected := range []*Request{request, seed} {
+		actual := requests[i]
+		if actual.URL != expected.URL ||
+			actual.Method != expected.Method ||
+			!reflect.DeepEqual(actual.Header, expected.Header) ||
+			!bytes.Equal(actual.Body, expected.Body) ||
+			actual.Priority != expected.Priority ||
+			actual.QueueName != expected.QueueName ||
+			!reflect.DeepEqual(actual.Meta, expected.Meta) ||
+			actual.URLHost() != expected.URLHost() {
+			t.Fatalf("test case %d: expected %+v, but got %+v", i, expected, actual)
+		}
+	}
+}
+
+func TestReadRequestsJSONL(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedNum     int
+		expectedIsError bool
+	}{
+		{"{\"url\":\"https://golang.org/\"}\n\n{\"url\":\"https://golang.org/doc/\"}", 2, false},
+		{"", 0, false},
+		{"{\"url\":\"https://golang.org/\"}\n{", 0, true},
+		{"{\"url\":\"%%\"}\n", 0, true},
+	}
+
+	for i, tt := range tests {
+		requests, err := ReadRequestsJSONL(strings.NewReader(tt.input))
+		if (err != nil) != tt.expectedIsError || len(requests) != tt.expectedNum {
+			t.Fatalf("test case %d: expected %d requests and error %v, but got %d and %v",
+				i, tt.expectedNum, tt.expectedIsError, len(requests), err)
+		}
+	}
+}
+
+func TestPublishRequestsJSONL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().PublishRequest(gomock.AssignableToTypeOf(&Request{})).Return(nil).Times(2)
+
+	input := "{\"url\":\"https://golang.org/\"}\n{\"url\":\"https://golang.org/doc/\",\"queue_name\":\"doc\"}\n"
+	published, err := PublishRequestsJSONL(strings.NewReader(input), workerQueueMock)
+	if err != nil || published != 2 {
+		t.Fatalf("expected 2 published requests, but got %d and %v", published, err)
+	}
+}
+
+func TestDumpRequestsJSONL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock := NewMockInspectableWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().PendingRequests().Return([]*Request{request}, nil)
+
+	buffer := &bytes.Buffer{}
+	dumped, err := DumpRequestsJSONL(buffer, workerQueueMock)
+	if err != nil || dumped != 1 {
+		t.Fatalf("expected 1 dumped request, but got %d and %v", dumped, err)
+	}
+
+	_, err = DumpRequestsJSONL(buffer, NewMockWorkerQueue(ctrl))
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+}
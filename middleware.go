@@ -0,0 +1,72 @@
+package arachne
+
+import (
+	"context"
+	"time"
+)
+
+// Action is what Worker does with a request after RequestMiddleware.
+type Action int
+
+const (
+	// ActionContinue passes the request to the next middleware, and fetches it after the last one.
+	ActionContinue Action = iota
+	// ActionDrop drops the request without fetching it.
+	ActionDrop
+	// ActionRetryLater puts the request back to the WorkerQueue to be fetched after Decision.Delay.
+	ActionRetryLater
+	// ActionRespond uses Decision.Response instead of fetching the request.
+	ActionRespond
+)
+
+// Decision is the result of RequestMiddleware.
+type Decision struct {
+	Action   Action
+	Delay    time.Duration
+	Response *Response
+}
+
+// Continue returns the decision to go on with the request.
+func Continue() Decision {
+	return Decision{Action: ActionContinue}
+}
+
+// Drop returns the decision to drop the request.
+func Drop() Decision {
+	return Decision{Action: ActionDrop}
+}
+
+// RetryLater returns the decision to fetch the request after delay.
+func RetryLater(delay time.Duration) Decision {
+	return Decision{Action: ActionRetryLater, Delay: delay}
+}
+
+// Respond returns the decision to use response instead of fetching the request.
+func Respond(response *Response) Decision {
+	return Decision{Action: ActionRespond, Response: response}
+}
+
+// RequestMiddleware processes a request before it is fetched.
+type RequestMiddleware interface {
+	// ProcessRequest decides what to do with the request.
+	// ctx is done when Worker.Shutdown aborts the in-flight requests.
+	// An error is handled like a failed fetch.
+	ProcessRequest(ctx context.Context, request *Request) (Decision, error)
+}
+
+// RequestMiddlewareFunc is an adapter to use a function as RequestMiddleware.
+type RequestMiddlewareFunc func(ctx context.Context, request *Request) (Decision, error)
+
+// ProcessRequest calls f(ctx, request).
+func (f RequestMiddlewareFunc) ProcessRequest(ctx context.Context, request *Request) (Decision, error) {
+	return f(ctx, request)
+}
+
+// AdaptRequestMiddleware adapts a function of Worker.RequestMiddlewares to RequestMiddleware.
+// The adapted middleware always continues, and Request.Meta["retry"] keeps skipping the fetch.
+func AdaptRequestMiddleware(f func(request *Request)) RequestMiddleware {
+	return RequestMiddlewareFunc(func(_ context.Context, request *Request) (Decision, error) {
+		f(request)
+		return Continue(), nil
+	})
+}
@@ -0,0 +1,297 @@
+package arachne
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func doRequestOnce(t *testing.T, worker *Worker, request *Request) []*Response {
+	input := make(chan *Request, 1)
+	input <- request
+	close(input)
+
+	output, err := worker.doRequest(input)
+	if err != nil {
+		t.Fatalf("fail to Worker#doRequest: %v", err)
+	}
+	responses := make([]*Response, 0)
+	for response := range output {
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestWorker_MiddlewareDrop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockAckingWorkerQueue(ctrl)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock.EXPECT().Ack(request).Return(nil).Times(1)
+
+	worker := newWorker(workerQueueMock, httpClientMock, loggerMock, nil, nil, nil)
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			return Drop(), nil
+		}),
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 0 {
+		t.Fatalf("expect no response, but got %v", responses)
+	}
+}
+
+func TestWorker_MiddlewareRetryLater(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockAckingWorkerQueue(ctrl)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	before := time.Now()
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).DoAndReturn(
+		func(retryRequest *Request) error {
+			if retryRequest.URL != request.URL {
+				t.Fatalf("expect %s, but got %s", request.URL, retryRequest.URL)
+			}
+			if retryRequest.NotBefore.Before(before.Add(time.Minute)) {
+				t.Fatalf("expect NotBefore after a minute, but got %v", retryRequest.NotBefore)
+			}
+			if retryRequest.Attempts != 0 {
+				t.Fatalf("expect no attempt, but got %d", retryRequest.Attempts)
+			}
+			return nil
+		},
+	).Times(1)
+	workerQueueMock.EXPECT().Ack(request).Return(nil).Times(1)
+
+	worker := newWorker(workerQueueMock, httpClientMock, loggerMock, nil, nil, nil)
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			return RetryLater(time.Minute), nil
+		}),
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 0 {
+		t.Fatalf("expect no response, but got %v", responses)
+	}
+}
+
+func TestWorker_MiddlewareLegacyRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	worker := newWorker(
+		nil,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){
+			func(request *Request) {
+				request.Meta["retry"] = true
+			},
+		},
+		nil,
+		nil,
+	)
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			t.Fatalf("expect Middlewares are skipped for the retried request")
+			return Continue(), nil
+		}),
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 1 || !responses[0].Request.isRetry() {
+		t.Fatalf("expect the retried request in a response, but got %v", responses)
+	}
+}
+
+func TestWorker_MiddlewareRetryLaterWithRetryFlag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockAckingWorkerQueue(ctrl)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).DoAndReturn(
+		func(retryRequest *Request) error {
+			if retryRequest.isRetry() {
+				t.Fatalf("expect retry flag is removed")
+			}
+			return nil
+		},
+	).Times(1)
+	workerQueueMock.EXPECT().Ack(request).Return(nil).Times(1)
+
+	worker := newWorker(workerQueueMock, httpClientMock, loggerMock, nil, nil, nil)
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			request.Meta["retry"] = true
+			return RetryLater(time.Minute), nil
+		}),
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 0 {
+		t.Fatalf("expect no response, but got %v", responses)
+	}
+}
+
+func TestWorker_MiddlewareRespond(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	order := make([]string, 0)
+
+	worker := newWorker(
+		nil,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){
+			func(request *Request) {
+				order = append(order, "legacy")
+			},
+		},
+		[]func(response *Response){
+			func(response *Response) {
+				order = append(order, "response")
+			},
+		},
+		nil,
+	)
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			order = append(order, "middleware")
+			return Respond(&Response{StatusCode: 200, Body: []byte("cached")}), nil
+		}),
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			t.Fatalf("expect the chain to stop")
+			return Continue(), nil
+		}),
+	}
+
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 1 {
+		t.Fatalf("expect a response, but got %v", responses)
+	}
+	if string(responses[0].Body) != "cached" {
+		t.Fatalf("expect cached, but got %s", responses[0].Body)
+	}
+	if responses[0].Request != request {
+		t.Fatalf("expect the subscribed request, but got %v", responses[0].Request)
+	}
+	if len(order) != 3 || order[0] != "legacy" || order[1] != "middleware" || order[2] != "response" {
+		t.Fatalf("expect [legacy middleware response], but got %v", order)
+	}
+}
+
+// pairedCounter is a pair of request and response middlewares like resource.RequestCounter.
+type pairedCounter chan struct{}
+
+func (c pairedCounter) requestMiddleware(request *Request) {
+	c <- struct{}{}
+}
+
+func (c pairedCounter) responseMiddleware(response *Response) {
+	<-c
+}
+
+func doRequestWithin(t *testing.T, worker *Worker, requests []*Request) []*Response {
+	input := make(chan *Request, len(requests))
+	for _, request := range requests {
+		input <- request
+	}
+	close(input)
+
+	output, err := worker.doRequest(input)
+	if err != nil {
+		t.Fatalf("fail to Worker#doRequest: %v", err)
+	}
+	responses := make([]*Response, 0)
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case response, ok := <-output:
+			if !ok {
+				return responses
+			}
+			responses = append(responses, response)
+		case <-timeout:
+			t.Fatalf("expected the pipeline to be drained, but it hangs")
+		}
+	}
+}
+
+func TestWorker_MiddlewareReleasesPairedMiddlewares(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Request: r}, nil
+		},
+	).Times(1)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).Return(nil).Times(1)
+
+	counter := make(pairedCounter, 1)
+	worker := newWorker(
+		workerQueueMock,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){counter.requestMiddleware},
+		[]func(response *Response){counter.responseMiddleware},
+		nil,
+	)
+	worker.FetchConcurrency = 1
+	worker.Middlewares = []RequestMiddleware{
+		RequestMiddlewareFunc(func(ctx context.Context, request *Request) (Decision, error) {
+			switch request.URL {
+			case "https://golang.org/drop":
+				return Drop(), nil
+			case "https://golang.org/later":
+				return RetryLater(time.Minute), nil
+			}
+			return Continue(), nil
+		}),
+	}
+
+	requests := make([]*Request, 0)
+	for _, u := range []string{"https://golang.org/drop", "https://golang.org/later", "https://golang.org/"} {
+		r, _ := NewGetRequest(u)
+		requests = append(requests, r)
+	}
+	responses := doRequestWithin(t, worker, requests)
+	if len(responses) != 1 || responses[0].StatusCode != 200 {
+		t.Fatalf("expect a response, but got %v", responses)
+	}
+}
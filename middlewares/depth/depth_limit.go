@@ -0,0 +1,49 @@
+package depth
+
+import (
+	"github.com/getumen/arachne"
+)
+
+// Limit limits and prioritizes requests by Request.Depth like DepthMiddleware of Scrapy.
+type Limit struct {
+	maxDepth         int
+	priorityPerDepth int64
+}
+
+// NewLimit creates Limit that drops requests deeper than maxDepth. Zero means no limit.
+func NewLimit(maxDepth int) *Limit {
+	return &Limit{
+		maxDepth: maxDepth,
+	}
+}
+
+// SetPriorityPerDepth makes Limit add Request.Depth * priorityPerDepth to Request.Priority.
+// A positive value down-prioritizes deep requests, which makes the crawl breadth-first,
+// and a negative value makes it depth-first.
+func (l *Limit) SetPriorityPerDepth(priorityPerDepth int64) *Limit {
+	l.priorityPerDepth = priorityPerDepth
+	return l
+}
+
+// SpiderMiddleware wraps spider so that the requests it outputs are limited and prioritized by depth.
+// Requests without Request.Referer become children of the request of the response
+// unless they are built by Response.FollowRequest.
+func (l *Limit) SpiderMiddleware(
+	spider func(response *arachne.Response) ([]*arachne.Request, error),
+) func(response *arachne.Response) ([]*arachne.Request, error) {
+	return func(response *arachne.Response) ([]*arachne.Request, error) {
+		requests, err := spider(response)
+		filtered := make([]*arachne.Request, 0, len(requests))
+		for _, request := range requests {
+			if request.Referer == "" && response.Request != nil {
+				request.SetParent(response.Request)
+			}
+			if l.maxDepth > 0 && request.Depth > l.maxDepth {
+				continue
+			}
+			request.Priority += int64(request.Depth) * l.priorityPerDepth
+			filtered = append(filtered, request)
+		}
+		return filtered, err
+	}
+}
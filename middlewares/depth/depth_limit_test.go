@@ -0,0 +1,39 @@
+package depth
+
+import (
+	"testing"
+
+	"github.com/getumen/arachne"
+)
+
+func TestLimit_SpiderMiddleware(t *testing.T) {
+	parent, _ := arachne.NewGetRequest("https://golang.org/doc/")
+	parent.Depth = 1
+	parent.SeedID = "https://golang.org/"
+	response := &arachne.Response{StatusCode: 200, Request: parent}
+
+	spider := func(response *arachne.Response) ([]*arachne.Request, error) {
+		followed, _ := response.FollowRequest("/doc/install")
+		deep, _ := arachne.NewGetRequest("https://golang.org/deep")
+		deep.SetParent(followed)
+		built, _ := arachne.NewGetRequest("https://golang.org/pkg/")
+		return []*arachne.Request{followed, deep, built}, nil
+	}
+
+	requests, err := NewLimit(2).SetPriorityPerDepth(10).SpiderMiddleware(spider)(response)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, but got %d", len(requests))
+	}
+	for _, request := range requests {
+		if request.Depth != 2 || request.Referer != parent.URL || request.SeedID != "https://golang.org/" {
+			t.Fatalf("unexpected parent link of %s: depth %d, referer %s, seed %s",
+				request.URL, request.Depth, request.Referer, request.SeedID)
+		}
+		if request.Priority != 20 {
+			t.Fatalf("expected priority 20 of %s, but got %d", request.URL, request.Priority)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// Limit is the rate of requests to a host.
+type Limit struct {
+	// Rate is the number of requests per second. Zero or less means no limit.
+	Rate float64
+	// Burst is the number of requests that can be sent at once. It is at least one.
+	Burst int
+}
+
+type hostLimit struct {
+	pattern string
+	limit   Limit
+}
+
+// bucket is a token bucket. tokens may be negative for the requests that are waiting.
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a RequestMiddleware that delays requests so that each host receives requests at its rate.
+type Limiter struct {
+	defaultLimit Limit
+	hostLimits   []hostLimit
+	crawlDelay   func(host string) (time.Duration, bool)
+	maxWait      time.Duration
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	sweepSize int
+	now       func() time.Time
+}
+
+// NewLimiter creates Limiter that sends rate requests per second with burst to each host.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		defaultLimit: Limit{Rate: rate, Burst: burst},
+		buckets:      map[string]*bucket{},
+		sweepSize:    1024,
+		now:          time.Now,
+	}
+}
+
+// SetHostLimit overrides the rate of the hosts that match pattern.
+// pattern is a host name without port, and may contain wildcards of path.Match like "*.example.com".
+// A host name equal to pattern takes precedence, and otherwise the first matching pattern is used.
+func (l *Limiter) SetHostLimit(pattern string, rate float64, burst int) *Limiter {
+	l.hostLimits = append(l.hostLimits, hostLimit{pattern: pattern, limit: Limit{Rate: rate, Burst: burst}})
+	return l
+}
+
+// SetCrawlDelay makes the hosts without SetHostLimit send a request per crawl delay, like Crawl-delay of robots.txt.
+// crawlDelay can be robots.Middleware.CrawlDelay, which must be applied before Limiter.
+func (l *Limiter) SetCrawlDelay(crawlDelay func(host string) (time.Duration, bool)) *Limiter {
+	l.crawlDelay = crawlDelay
+	return l
+}
+
+// SetMaxWait makes a request that would wait longer than maxWait be retried later through the WorkerQueue
+// instead of holding the fetch goroutine. Zero means requests always wait.
+func (l *Limiter) SetMaxWait(maxWait time.Duration) *Limiter {
+	l.maxWait = maxWait
+	return l
+}
+
+// ProcessRequest waits until the host of the request can receive it.
+func (l *Limiter) ProcessRequest(ctx context.Context, request *arachne.Request) (arachne.Decision, error) {
+	requestURL, err := url.Parse(request.URL)
+	if err != nil {
+		return arachne.Decision{}, xerrors.Errorf("fail to parse url %s: %w", request.URL, err)
+	}
+	wait, ok := l.reserve(requestURL.Host)
+	if !ok {
+		return arachne.RetryLater(wait), nil
+	}
+	if wait <= 0 {
+		return arachne.Continue(), nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return arachne.Continue(), nil
+	case <-ctx.Done():
+		return arachne.Decision{}, xerrors.Errorf("fail to wait for rate limit of %s: %w", requestURL.Host, ctx.Err())
+	}
+}
+
+// Limit returns the rate of host, which is the host of the request URL including the port if any.
+// The patterns of SetHostLimit are matched with the host name without port,
+// and crawl delays are looked up by host as robots.Middleware caches them.
+func (l *Limiter) Limit(host string) Limit {
+	hostname := (&url.URL{Host: host}).Hostname()
+	for _, hostLimit := range l.hostLimits {
+		if hostLimit.pattern == hostname {
+			return hostLimit.limit
+		}
+	}
+	for _, hostLimit := range l.hostLimits {
+		if matched, _ := path.Match(hostLimit.pattern, hostname); matched {
+			return hostLimit.limit
+		}
+	}
+	if l.crawlDelay != nil {
+		if delay, ok := l.crawlDelay(host); ok && delay > 0 {
+			return Limit{Rate: float64(time.Second) / float64(delay), Burst: 1}
+		}
+	}
+	return l.defaultLimit
+}
+
+// reserve takes a token of the bucket of host and returns how long the request waits for it.
+// It reports false without taking the token if the request should not wait that long.
+func (l *Limiter) reserve(host string) (time.Duration, bool) {
+	limit := l.Limit(host)
+	if limit.Rate <= 0 {
+		return 0, true
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	b, ok := l.buckets[host]
+	if !ok {
+		l.sweep(now)
+		b = &bucket{limit: limit, tokens: burst, last: now}
+		l.buckets[host] = b
+	}
+	b.limit = limit
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	tokens := b.tokens - 1
+	var wait time.Duration
+	if tokens < 0 {
+		wait = time.Duration(-tokens / limit.Rate * float64(time.Second))
+	}
+	if l.maxWait > 0 && wait > l.maxWait {
+		return wait, false
+	}
+	b.tokens = tokens
+	return wait, true
+}
+
+// sweep forgets the buckets that are full when the number of buckets reaches sweepSize. mutex must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if len(l.buckets) < l.sweepSize {
+		return
+	}
+	for key, b := range l.buckets {
+		burst := math.Max(float64(b.limit.Burst), 1)
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets)*2 > l.sweepSize {
+		l.sweepSize = len(l.buckets) * 2
+	}
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+	"github.com/getumen/arachne/middlewares/robots"
+)
+
+func TestLimiter_reserve(t *testing.T) {
+	target := NewLimiter(2, 2)
+	now := time.Now()
+	target.now = func() time.Time { return now }
+
+	for i, expected := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		wait, ok := target.reserve("example.com")
+		if !ok || wait != expected {
+			t.Fatalf("request %d: expect %v, but got %v", i, expected, wait)
+		}
+	}
+	// other hosts have their own buckets
+	if wait, _ := target.reserve("golang.org"); wait != 0 {
+		t.Fatalf("expect no wait, but got %v", wait)
+	}
+
+	now = now.Add(2 * time.Second)
+	if wait, _ := target.reserve("example.com"); wait != 0 {
+		t.Fatalf("expect no wait after refill, but got %v", wait)
+	}
+}
+
+func TestLimiter_Limit(t *testing.T) {
+	target := NewLimiter(10, 1).
+		SetHostLimit("*.example.com", 2, 1).
+		SetHostLimit("api.example.com", 1, 5).
+		SetCrawlDelay(func(host string) (time.Duration, bool) {
+			return 4 * time.Second, host == "slow.org" || host == "www.example.com"
+		})
+
+	for _, c := range []struct {
+		host     string
+		expected Limit
+	}{
+		{"api.example.com", Limit{Rate: 1, Burst: 5}},
+		{"www.example.com", Limit{Rate: 2, Burst: 1}},
+		{"example.com", Limit{Rate: 10, Burst: 1}},
+		{"slow.org", Limit{Rate: 0.25, Burst: 1}},
+	} {
+		actual := target.Limit(c.host)
+		if actual != c.expected {
+			t.Fatalf("%s: expect %v, but got %v", c.host, c.expected, actual)
+		}
+	}
+}
+
+func TestLimiter_ProcessRequest(t *testing.T) {
+	target := NewLimiter(1, 1).SetMaxWait(time.Millisecond)
+	request, _ := arachne.NewGetRequest("https://example.com:8080/")
+
+	decision, err := target.ProcessRequest(context.Background(), request)
+	if err != nil || decision.Action != arachne.ActionContinue {
+		t.Fatalf("expect continue, but got %v %v", decision, err)
+	}
+	decision, err = target.ProcessRequest(context.Background(), request)
+	if err != nil || decision.Action != arachne.ActionRetryLater || decision.Delay <= 0 {
+		t.Fatalf("expect retry later, but got %v %v", decision, err)
+	}
+
+	target.SetMaxWait(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = target.ProcessRequest(ctx, request)
+	if err == nil {
+		t.Fatalf("expect error after ctx is done, but got nil")
+	}
+
+	target = NewLimiter(100, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		decision, err = target.ProcessRequest(context.Background(), request)
+		if err != nil || decision.Action != arachne.ActionContinue {
+			t.Fatalf("expect continue, but got %v %v", decision, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("expect requests to be delayed, but took %v", elapsed)
+	}
+}
+
+func TestLimiter_CrawlDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nCrawl-delay: 4\n"))
+	}))
+	defer server.Close()
+
+	robotsMiddleware := robots.NewMiddleware(server.Client(), "AnyBot/1.0", time.Hour)
+	target := NewLimiter(10, 1).SetCrawlDelay(robotsMiddleware.CrawlDelay)
+	request, _ := arachne.NewGetRequest(server.URL + "/")
+	decision, err := robotsMiddleware.ProcessRequest(context.Background(), request)
+	if err != nil || decision.Action != arachne.ActionContinue {
+		t.Fatalf("expect continue, but got %v %v", decision, err)
+	}
+
+	// the server listens on a port, which is a part of the key of the crawl delay
+	serverURL, _ := url.Parse(server.URL)
+	expected := Limit{Rate: 0.25, Burst: 1}
+	if actual := target.Limit(serverURL.Host); actual != expected {
+		t.Fatalf("expect %v, but got %v", expected, actual)
+	}
+
+	target.SetMaxWait(time.Millisecond)
+	for i, expected := range []arachne.Action{arachne.ActionContinue, arachne.ActionRetryLater} {
+		decision, err := target.ProcessRequest(context.Background(), request)
+		if err != nil || decision.Action != expected {
+			t.Fatalf("request %d: expect %v, but got %v %v", i, expected, decision, err)
+		}
+	}
+}
+
+func TestLimiter_sweep(t *testing.T) {
+	target := NewLimiter(1, 1)
+	target.sweepSize = 2
+	now := time.Now()
+	target.now = func() time.Time { return now }
+
+	target.reserve("a.com")
+	target.reserve("b.com")
+	now = now.Add(time.Second)
+	target.reserve("c.com")
+
+	if len(target.buckets) != 1 {
+		t.Fatalf("expect the full buckets to be forgotten, but got %d buckets", len(target.buckets))
+	}
+}
@@ -0,0 +1,250 @@
+package resource
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ewmaWeight is the weight of a new sample in the moving averages of AutoThrottle.
+	ewmaWeight = 0.3
+	// errorRateThreshold is the error rate above which AutoThrottle decreases the concurrency of a host.
+	errorRateThreshold = 0.1
+)
+
+// AutoThrottle is a downloader middleware that adapts the concurrency and the delay of each host
+// to its latency and errors, like AutoThrottle of Scrapy.
+// The delay of a host approaches latency / targetConcurrency so that targetConcurrency requests
+// are in flight on average, and the concurrency grows by one per round trip while the host succeeds.
+// 429 and 503 halve the concurrency and double the delay.
+type AutoThrottle struct {
+	targetConcurrency float64
+	maxConcurrency    int
+	minDelay          time.Duration
+	maxDelay          time.Duration
+
+	counts *MemoryDomainCounter
+	mutex  sync.Mutex
+	hosts  map[string]*throttle
+	now    func() time.Time
+}
+
+type throttle struct {
+	concurrency float64
+	delay       time.Duration
+	latency     time.Duration
+	errorRate   float64
+	sampled     bool
+	nextAt      time.Time
+}
+
+// ThrottleState is the current settings and observations of a host.
+type ThrottleState struct {
+	Concurrency int
+	Delay       time.Duration
+	Latency     time.Duration
+	ErrorRate   float64
+	InFlight    int64
+}
+
+// NewAutoThrottle creates AutoThrottle that keeps targetConcurrency requests in flight per host
+// with at most maxConcurrency requests and a delay between minDelay and maxDelay.
+func NewAutoThrottle(targetConcurrency float64, maxConcurrency int, minDelay, maxDelay time.Duration) *AutoThrottle {
+	return &AutoThrottle{
+		targetConcurrency: math.Max(targetConcurrency, 1),
+		maxConcurrency:    maxConcurrency,
+		minDelay:          minDelay,
+		maxDelay:          maxDelay,
+		counts:            NewMemoryDomainCounter(),
+		hosts:             map[string]*throttle{},
+		now:               time.Now,
+	}
+}
+
+// DownloaderMiddleware is downloader middleware that waits for the concurrency and the delay of the host,
+// and observes the latency and the outcome of the fetch.
+func (a *AutoThrottle) DownloaderMiddleware(next arachne.HTTPClient) arachne.HTTPClient {
+	return arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		err := a.wait(req.Context(), host)
+		if err != nil {
+			return nil, err
+		}
+		defer a.counts.release(host)
+
+		start := a.now()
+		resp, err := next.Do(req)
+		if req.Context().Err() == nil {
+			a.observe(host, a.now().Sub(start), resp, err)
+		}
+		return resp, err
+	})
+}
+
+// State returns the current settings of host.
+func (a *AutoThrottle) State(host string) (ThrottleState, bool) {
+	a.mutex.Lock()
+	t, ok := a.hosts[host]
+	if !ok {
+		a.mutex.Unlock()
+		return ThrottleState{}, false
+	}
+	state := t.state()
+	a.mutex.Unlock()
+
+	state.InFlight = a.counts.count(host)
+	return state, true
+}
+
+// States returns the current settings of the hosts that have been fetched.
+func (a *AutoThrottle) States() map[string]ThrottleState {
+	a.mutex.Lock()
+	states := make(map[string]ThrottleState, len(a.hosts))
+	for host, t := range a.hosts {
+		states[host] = t.state()
+	}
+	a.mutex.Unlock()
+
+	for host, state := range states {
+		state.InFlight = a.counts.count(host)
+		states[host] = state
+	}
+	return states
+}
+
+func (t *throttle) state() ThrottleState {
+	return ThrottleState{
+		Concurrency: int(t.concurrency),
+		Delay:       t.delay,
+		Latency:     t.latency,
+		ErrorRate:   t.errorRate,
+	}
+}
+
+// throttle returns the throttle of host. mutex must be held.
+func (a *AutoThrottle) throttle(host string) *throttle {
+	t, ok := a.hosts[host]
+	if !ok {
+		t = &throttle{concurrency: 1, delay: a.minDelay}
+		a.hosts[host] = t
+	}
+	return t
+}
+
+// wait waits until a request can be sent to host, and counts it in flight.
+func (a *AutoThrottle) wait(ctx context.Context, host string) error {
+	for {
+		a.mutex.Lock()
+		t := a.throttle(host)
+		now := a.now()
+		wait := t.nextAt.Sub(now)
+		concurrency := int64(t.concurrency)
+		a.mutex.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				return xerrors.Errorf("fail to wait for the delay of %s: %w", host, ctx.Err())
+			}
+		}
+
+		ok, released := a.counts.acquire(host, concurrency)
+		if !ok {
+			select {
+			case <-released:
+				continue
+			case <-ctx.Done():
+				return xerrors.Errorf("fail to wait for the concurrency of %s: %w", host, ctx.Err())
+			}
+		}
+
+		a.mutex.Lock()
+		if t.nextAt.After(now) {
+			// another request has taken the slot
+			a.mutex.Unlock()
+			a.counts.release(host)
+			continue
+		}
+		t.nextAt = now.Add(t.delay)
+		a.mutex.Unlock()
+		return nil
+	}
+}
+
+// observe adjusts the throttle of host to the outcome of a fetch.
+func (a *AutoThrottle) observe(host string, latency time.Duration, resp *http.Response, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	t := a.throttle(host)
+
+	failed := err != nil || resp.StatusCode >= 500
+	if failed {
+		t.errorRate = ewma(t.errorRate, 1)
+	} else {
+		t.errorRate = ewma(t.errorRate, 0)
+	}
+
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		// back off sharply
+		t.concurrency = math.Max(1, t.concurrency/2)
+		t.delay = a.clampDelay(maxDuration(2*t.delay, time.Second))
+		return
+	}
+
+	if err == nil {
+		if !t.sampled {
+			t.latency = latency
+			t.sampled = true
+		} else {
+			t.latency = time.Duration(ewma(float64(t.latency), float64(latency)))
+		}
+	}
+	targetDelay := time.Duration(float64(t.latency) / a.targetConcurrency)
+
+	if failed {
+		// errors do not speed up the host
+		t.delay = a.clampDelay(maxDuration(t.delay, targetDelay))
+		if t.errorRate > errorRateThreshold {
+			t.concurrency = math.Max(1, t.concurrency*0.75)
+		}
+		return
+	}
+	t.delay = a.clampDelay((t.delay + targetDelay) / 2)
+	if t.errorRate <= errorRateThreshold {
+		t.concurrency += 1 / t.concurrency
+		if a.maxConcurrency > 0 && t.concurrency > float64(a.maxConcurrency) {
+			t.concurrency = float64(a.maxConcurrency)
+		}
+	}
+}
+
+func (a *AutoThrottle) clampDelay(delay time.Duration) time.Duration {
+	if delay < a.minDelay {
+		return a.minDelay
+	}
+	if a.maxDelay > 0 && delay > a.maxDelay {
+		return a.maxDelay
+	}
+	return delay
+}
+
+func ewma(average, sample float64) float64 {
+	return average*(1-ewmaWeight) + sample*ewmaWeight
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
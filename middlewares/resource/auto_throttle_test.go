@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func TestAutoThrottle_observe(t *testing.T) {
+	target := NewAutoThrottle(2, 4, 0, 10*time.Second)
+	ok := &http.Response{StatusCode: 200}
+
+	target.observe("example.com", time.Second, ok, nil)
+	state, _ := target.State("example.com")
+	if state.Latency != time.Second || state.Delay != 250*time.Millisecond || state.Concurrency != 2 {
+		t.Fatalf("unexpected state after a success: %+v", state)
+	}
+
+	for i := 0; i < 20; i++ {
+		target.observe("example.com", time.Second, ok, nil)
+	}
+	state, _ = target.State("example.com")
+	if state.Concurrency != 4 {
+		t.Fatalf("expect the concurrency to reach the max, but got %+v", state)
+	}
+	if state.Delay < 490*time.Millisecond || state.Delay > 500*time.Millisecond {
+		t.Fatalf("expect the delay to approach latency / target, but got %+v", state)
+	}
+
+	target.observe("example.com", time.Second, &http.Response{StatusCode: http.StatusTooManyRequests}, nil)
+	state, _ = target.State("example.com")
+	if state.Concurrency != 2 || state.Delay != time.Second {
+		t.Fatalf("expect to back off on 429, but got %+v", state)
+	}
+
+	for i := 0; i < 3; i++ {
+		target.observe("example.com", 0, nil, errors.New("error"))
+	}
+	state, _ = target.State("example.com")
+	if state.Concurrency != 1 || state.ErrorRate < 0.5 || state.Delay < time.Second {
+		t.Fatalf("expect to slow down on errors, but got %+v", state)
+	}
+
+	if _, ok := target.State("golang.org"); ok {
+		t.Fatalf("expect no state of unknown host")
+	}
+}
+
+func TestAutoThrottle_DownloaderMiddleware(t *testing.T) {
+	target := NewAutoThrottle(1, 1, 0, time.Second)
+	var inFlight, maxInFlight int64
+	client := target.DownloaderMiddleware(arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return &http.Response{StatusCode: 200, Request: req}, nil
+	}))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+			_, err := client.Do(req)
+			if err != nil {
+				t.Errorf("fail to do request: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 1 {
+		t.Fatalf("expect a request in flight, but got %d", maxInFlight)
+	}
+	states := target.States()
+	if state := states["example.com"]; state.InFlight != 0 || state.Latency <= 0 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+}
@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"sync"
+)
+
+// DomainCounter counts the in-flight requests of each host.
+// Worker processes that share a DomainCounter enforce a shared per-domain limit.
+type DomainCounter interface {
+	// Acquire increments the count of host unless it has reached max, and reports whether it did.
+	Acquire(host string, max int64) (bool, error)
+	// Release decrements the count of host.
+	Release(host string) error
+	// Count returns the count of host.
+	Count(host string) (int64, error)
+}
+
+// MemoryDomainCounter is DomainCounter in memory.
+type MemoryDomainCounter struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+	// released is closed when a request is released.
+	released chan struct{}
+}
+
+// NewMemoryDomainCounter creates MemoryDomainCounter.
+func NewMemoryDomainCounter() *MemoryDomainCounter {
+	return &MemoryDomainCounter{
+		counts:   map[string]int64{},
+		released: make(chan struct{}),
+	}
+}
+
+// Acquire increments the count of host unless it has reached max, and reports whether it did.
+func (d *MemoryDomainCounter) Acquire(host string, max int64) (bool, error) {
+	ok, _ := d.acquire(host, max)
+	return ok, nil
+}
+
+// Release decrements the count of host.
+func (d *MemoryDomainCounter) Release(host string) error {
+	d.release(host)
+	return nil
+}
+
+// Count returns the count of host.
+func (d *MemoryDomainCounter) Count(host string) (int64, error) {
+	return d.count(host), nil
+}
+
+// acquire is Acquire that also returns the channel closed when a request is released,
+// so that the caller can wait for it on failure.
+func (d *MemoryDomainCounter) acquire(host string, max int64) (bool, <-chan struct{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	count := d.counts[host]
+	if count >= max {
+		return false, d.released
+	}
+	d.counts[host] = count + 1
+	return true, d.released
+}
+
+func (d *MemoryDomainCounter) release(host string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	count, ok := d.counts[host]
+	if !ok {
+		return
+	}
+	if count == 1 {
+		delete(d.counts, host)
+	} else {
+		d.counts[host] = count - 1
+	}
+	close(d.released)
+	d.released = make(chan struct{})
+}
+
+func (d *MemoryDomainCounter) count(host string) int64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.counts[host]
+}
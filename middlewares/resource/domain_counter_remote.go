@@ -0,0 +1,273 @@
+package resource
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	opAcquire = "acquire"
+	opRelease = "release"
+	opCount   = "count"
+)
+
+type domainCounterRequest struct {
+	Op   string `json:"op"`
+	Host string `json:"host"`
+	Max  int64  `json:"max,omitempty"`
+}
+
+type domainCounterResponse struct {
+	OK    bool   `json:"ok"`
+	Count int64  `json:"count"`
+	Error string `json:"error,omitempty"`
+}
+
+// DomainCounterServer serves DomainCounter to RemoteDomainCounters over TCP or Unix domain sockets.
+// The counts acquired through a connection are released when it is closed,
+// so a worker that dies does not leak them.
+type DomainCounterServer struct {
+	counter DomainCounter
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewDomainCounterServer creates DomainCounterServer that serves counter.
+func NewDomainCounterServer(counter DomainCounter) *DomainCounterServer {
+	return &DomainCounterServer{
+		counter:   counter,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// Serve accepts connections on listener until Close is called, and then returns nil.
+func (s *DomainCounterServer) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return xerrors.New("server is closed")
+	}
+	s.listeners[listener] = struct{}{}
+	s.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return xerrors.Errorf("fail to accept connection: %w", err)
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Close closes the listeners and the connections, and waits for the connections to release their counts.
+func (s *DomainCounterServer) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *DomainCounterServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	held := map[string]int64{}
+	defer func() {
+		for host, count := range held {
+			for ; count > 0; count-- {
+				s.counter.Release(host)
+			}
+		}
+		conn.Close()
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+	}()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		var request domainCounterRequest
+		err := decoder.Decode(&request)
+		if err != nil {
+			return
+		}
+		response := s.do(request, held)
+		err = encoder.Encode(response)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// do applies the request to the counter and records the counts held by the connection in held.
+func (s *DomainCounterServer) do(request domainCounterRequest, held map[string]int64) domainCounterResponse {
+	var response domainCounterResponse
+	var err error
+	switch request.Op {
+	case opAcquire:
+		response.OK, err = s.counter.Acquire(request.Host, request.Max)
+		if err == nil && response.OK {
+			held[request.Host]++
+		}
+	case opRelease:
+		// ignore the counts that the connection does not hold, like those released on reconnection
+		if held[request.Host] > 0 {
+			err = s.counter.Release(request.Host)
+			if err == nil {
+				held[request.Host]--
+				if held[request.Host] == 0 {
+					delete(held, request.Host)
+				}
+			}
+		}
+		response.OK = err == nil
+	case opCount:
+		response.Count, err = s.counter.Count(request.Host)
+		response.OK = err == nil
+	default:
+		err = xerrors.Errorf("unknown op %s", request.Op)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response
+}
+
+// RemoteDomainCounter is DomainCounter served by DomainCounterServer.
+// It is safe for concurrent use, and reconnects after a connection error.
+type RemoteDomainCounter struct {
+	network string
+	address string
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+// DialDomainCounter connects to DomainCounterServer at address of network such as "tcp" or "unix".
+func DialDomainCounter(network, address string) (*RemoteDomainCounter, error) {
+	c := &RemoteDomainCounter{
+		network: network,
+		address: address,
+		timeout: 5 * time.Second,
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Acquire increments the count of host unless it has reached max, and reports whether it did.
+func (c *RemoteDomainCounter) Acquire(host string, max int64) (bool, error) {
+	response, err := c.call(domainCounterRequest{Op: opAcquire, Host: host, Max: max})
+	if err != nil {
+		return false, err
+	}
+	return response.OK, nil
+}
+
+// Release decrements the count of host.
+func (c *RemoteDomainCounter) Release(host string) error {
+	_, err := c.call(domainCounterRequest{Op: opRelease, Host: host})
+	return err
+}
+
+// Count returns the count of host.
+func (c *RemoteDomainCounter) Count(host string) (int64, error) {
+	response, err := c.call(domainCounterRequest{Op: opCount, Host: host})
+	if err != nil {
+		return 0, err
+	}
+	return response.Count, nil
+}
+
+// Close closes the connection. The server releases the counts acquired through it.
+func (c *RemoteDomainCounter) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// connect dials the server. mutex must be held.
+func (c *RemoteDomainCounter) connect() error {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return xerrors.Errorf("fail to connect to domain counter %s: %w", c.address, err)
+	}
+	c.conn = conn
+	c.encoder = json.NewEncoder(conn)
+	c.decoder = json.NewDecoder(conn)
+	return nil
+}
+
+func (c *RemoteDomainCounter) call(request domainCounterRequest) (domainCounterResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var response domainCounterResponse
+	if c.conn == nil {
+		err := c.connect()
+		if err != nil {
+			return response, err
+		}
+	}
+	err := c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err == nil {
+		err = c.encoder.Encode(request)
+	}
+	if err == nil {
+		err = c.decoder.Decode(&response)
+	}
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return response, xerrors.Errorf("fail to call domain counter %s: %w", c.address, err)
+	}
+	if response.Error != "" {
+		return response, xerrors.Errorf("domain counter %s: %s", c.address, response.Error)
+	}
+	return response, nil
+}
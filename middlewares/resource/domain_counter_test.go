@@ -0,0 +1,117 @@
+package resource
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func TestMemoryDomainCounter(t *testing.T) {
+	target := NewMemoryDomainCounter()
+	for i, expected := range []bool{true, true, false} {
+		ok, err := target.Acquire("golang.org", 2)
+		if err != nil || ok != expected {
+			t.Fatalf("acquire %d: expect %v, but got %v %v", i, expected, ok, err)
+		}
+	}
+	if count, _ := target.Count("golang.org"); count != 2 {
+		t.Fatalf("expected %d, but got %d", 2, count)
+	}
+	target.Release("golang.org")
+	target.Release("golang.org")
+	target.Release("golang.org")
+	if count, _ := target.Count("golang.org"); count != 0 {
+		t.Fatalf("expected %d, but got %d", 0, count)
+	}
+}
+
+func TestInMemoryDomainCounter_Independent(t *testing.T) {
+	first := NewInMemoryDomainCounter(1)
+	second := NewInMemoryDomainCounter(1)
+
+	for _, target := range []*InMemoryDomainCounter{first, second} {
+		request, _ := arachne.NewGetRequest("https://golang.org/")
+		target.RequestMiddleware(request)
+		if _, ok := request.Meta["retry"]; ok {
+			t.Fatalf("expected the instances not to share counts")
+		}
+	}
+}
+
+func startDomainCounterServer(t *testing.T) (*DomainCounterServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("fail to listen: %v", err)
+	}
+	server := NewDomainCounterServer(NewMemoryDomainCounter())
+	go func() {
+		err := server.Serve(listener)
+		if err != nil {
+			t.Errorf("fail to serve: %v", err)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func TestRemoteDomainCounter(t *testing.T) {
+	server, address := startDomainCounterServer(t)
+	defer server.Close()
+
+	first, err := DialDomainCounter("tcp", address)
+	if err != nil {
+		t.Fatalf("fail to dial: %v", err)
+	}
+	defer first.Close()
+	second, err := DialDomainCounter("tcp", address)
+	if err != nil {
+		t.Fatalf("fail to dial: %v", err)
+	}
+
+	// workers share the limit
+	firstLimit := NewDomainLimit(first, 1)
+	secondLimit := NewDomainLimit(second, 1)
+	request, _ := arachne.NewGetRequest("https://golang.org/")
+	firstLimit.RequestMiddleware(request)
+	if _, ok := request.Meta["retry"]; ok {
+		t.Fatalf("expected the first request to be acquired")
+	}
+	request, _ = arachne.NewGetRequest("https://golang.org/")
+	secondLimit.RequestMiddleware(request)
+	if _, ok := request.Meta["retry"]; !ok {
+		t.Fatalf("expected the second request to exceed the shared limit")
+	}
+
+	// a counter releases only what it holds
+	if err := second.Release("golang.org"); err != nil {
+		t.Fatalf("fail to release: %v", err)
+	}
+	if count, _ := first.Count("golang.org"); count != 1 {
+		t.Fatalf("expected %d, but got %d", 1, count)
+	}
+
+	// the counts of a closed connection are released
+	first.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		count, err := second.Count("golang.org")
+		if err != nil {
+			t.Fatalf("fail to count: %v", err)
+		}
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the counts of the closed connection to be released, but got %d", count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	second.Close()
+
+	// the counter reconnects
+	ok, err := first.Acquire("golang.org", 1)
+	if err != nil || !ok {
+		t.Fatalf("expected to acquire after reconnection, but got %v %v", ok, err)
+	}
+}
@@ -1,66 +1,120 @@
 package resource
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"sync"
+	"net/http"
+	"time"
 
 	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
 )
 
-var (
-	mutex         sync.Mutex
-	domainCounter map[string]int64
-)
+// domainLimitRetryDelay is the delay of the retry of a request whose host is full
+// when the counter cannot tell when a request is released.
+const domainLimitRetryDelay = time.Second
 
-func init() {
-	mutex = sync.Mutex{}
-	domainCounter = map[string]int64{}
+// DomainLimit limits the in-flight requests of each host with the counts of DomainCounter.
+type DomainLimit struct {
+	counter         DomainCounter
+	maxRequestCount int64
+	// hostKey is the key of Request.Meta that keeps the host acquired by RequestMiddleware.
+	hostKey string
 }
 
-// InMemoryDomainCounter is an in-memory domain counter
-type InMemoryDomainCounter struct {
-	maxRequestCount int64
+// InMemoryDomainCounter is DomainLimit whose counts are kept in memory by the instance.
+type InMemoryDomainCounter = DomainLimit
+
+// NewDomainLimit creates DomainLimit that allows maxRequestCount requests in flight per host.
+// Workers that share counter share the limit.
+func NewDomainLimit(counter DomainCounter, maxRequestCount int64) *DomainLimit {
+	c := &DomainLimit{
+		counter:         counter,
+		maxRequestCount: maxRequestCount,
+	}
+	c.hostKey = fmt.Sprintf("domain_limit_%p", c)
+	return c
 }
 
 // NewInMemoryDomainCounter is the InMemoryDomainCounter constructor
 func NewInMemoryDomainCounter(maxRequestCount int64) *InMemoryDomainCounter {
-	return &InMemoryDomainCounter{
-		maxRequestCount: maxRequestCount,
-	}
+	return NewDomainLimit(NewMemoryDomainCounter(), maxRequestCount)
 }
 
 // RequestMiddleware is request middleware
-func (c *InMemoryDomainCounter) RequestMiddleware(request *arachne.Request) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	count, ok := domainCounter[request.URLHost()]
-	if ok {
-		if count >= c.maxRequestCount {
-			request.Meta["retry"] = true
-			return
-		}
+func (c *DomainLimit) RequestMiddleware(request *arachne.Request) {
+	ok, err := c.counter.Acquire(request.URLHost(), c.maxRequestCount)
+	if err != nil {
+		log.Printf("fail to acquire %s: %v", request.URLHost(), err)
+	}
+	if !ok {
+		request.Meta["retry"] = true
+		return
 	}
-	count++
-	domainCounter[request.URLHost()] = count
+	request.Meta[c.hostKey] = request.URLHost()
 }
 
-// ResponseMiddleware is response middleware
-func (c *InMemoryDomainCounter) ResponseMiddleware(response *arachne.Response) {
+// ResponseMiddleware is response middleware.
+// It releases the host acquired by RequestMiddleware, which differs from the host of the response after redirects.
+func (c *DomainLimit) ResponseMiddleware(response *arachne.Response) {
 	if retry, ok := response.Request.Meta["retry"]; ok {
 		if retryFlag, ok := retry.(bool); retryFlag && ok {
 			return
 		}
 	}
-	mutex.Lock()
-	defer mutex.Unlock()
-	count, ok := domainCounter[response.Request.URLHost()]
+	host, ok := response.Request.Meta[c.hostKey].(string)
 	if ok {
-		if count > 0 {
-			count--
-			domainCounter[response.Request.URLHost()] = count
-		} else {
-			// this never happened
-			log.Panicf("the InMemoryDomainCounter is broken. count cannot be negative.")
+		delete(response.Request.Meta, c.hostKey)
+	} else {
+		host = response.Request.URLHost()
+	}
+	c.release(host)
+}
+
+// DownloaderMiddleware is downloader middleware that holds the count of the host during the fetch.
+// If the host has maxRequestCount requests in flight, the fetch waits until one of them is released
+// with MemoryDomainCounter, and the request is retried after a second with other counters.
+func (c *DomainLimit) DownloaderMiddleware(next arachne.HTTPClient) arachne.HTTPClient {
+	return arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		err := c.wait(req.Context(), req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		defer c.release(req.URL.Host)
+		return next.Do(req)
+	})
+}
+
+// wait acquires the count of host, waiting for a release while ctx is not done if the counter is MemoryDomainCounter.
+func (c *DomainLimit) wait(ctx context.Context, host string) error {
+	counter, ok := c.counter.(*MemoryDomainCounter)
+	if !ok {
+		ok, err := c.counter.Acquire(host, c.maxRequestCount)
+		if err != nil {
+			return xerrors.Errorf("fail to acquire %s: %w", host, err)
+		}
+		if !ok {
+			return &arachne.RetryLaterError{Delay: domainLimitRetryDelay}
 		}
+		return nil
+	}
+	for {
+		ok, released := counter.acquire(host, c.maxRequestCount)
+		if ok {
+			return nil
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return xerrors.Errorf("fail to wait for the limit of %s: %w", host, ctx.Err())
+		}
+	}
+}
+
+func (c *DomainLimit) release(host string) {
+	err := c.counter.Release(host)
+	if err != nil {
+		log.Printf("fail to release %s: %v", host, err)
 	}
 }
@@ -1,11 +1,16 @@
 package resource
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
 )
 
 func TestInMemoryDomainCounter_RequestMiddleware(t *testing.T) {
@@ -41,7 +46,7 @@ func TestInMemoryDomainCounter_ResponseMiddleware(t *testing.T) {
 	var i int64
 
 	target := NewInMemoryDomainCounter(maxRequestCount)
-	domainCounter["golang.org"] = 1000
+	target.counter.(*MemoryDomainCounter).counts["golang.org"] = 1000
 	wg := sync.WaitGroup{}
 	for i = 0; i < loop; i++ {
 		wg.Add(1)
@@ -53,7 +58,93 @@ func TestInMemoryDomainCounter_ResponseMiddleware(t *testing.T) {
 		}()
 	}
 	wg.Wait()
-	if domainCounter["golang.org"] != 0 {
-		t.Fatalf("expected %d, but got %d", 0, domainCounter["golang.org"])
+	if target.counter.(*MemoryDomainCounter).count("golang.org") != 0 {
+		t.Fatalf("expected %d, but got %d", 0, target.counter.(*MemoryDomainCounter).count("golang.org"))
+	}
+}
+
+func TestInMemoryDomainCounter_ResponseMiddlewareRedirect(t *testing.T) {
+	target := NewInMemoryDomainCounter(1)
+	request, _ := arachne.NewGetRequest("https://golang.org/")
+	target.RequestMiddleware(request)
+
+	// the response of a redirect to another host shares Meta with the subscribed request
+	redirected, _ := arachne.NewGetRequest("https://go.dev/")
+	redirected.Meta = request.Meta
+	target.ResponseMiddleware(&arachne.Response{Request: redirected})
+	if count := target.counter.(*MemoryDomainCounter).count("golang.org"); count != 0 {
+		t.Fatalf("expected the acquired host to be released, but got %d", count)
+	}
+}
+
+func TestInMemoryDomainCounter_DownloaderMiddleware(t *testing.T) {
+	target := NewInMemoryDomainCounter(1)
+	var client arachne.HTTPClient
+	fetching := make(chan struct{})
+	done := make(chan struct{})
+	client = target.DownloaderMiddleware(arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/first" {
+			close(fetching)
+			<-done
+		}
+		return nil, errors.New("error")
+	}))
+
+	first, _ := http.NewRequest(http.MethodGet, "https://example.com/first", nil)
+	second, _ := http.NewRequest(http.MethodGet, "https://example.com/second", nil)
+	go client.Do(first)
+	<-fetching
+
+	// the host is busy during the fetch, so the request waits until its context is done
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelFunc()
+	_, err := client.Do(second.WithContext(ctx))
+	if !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+
+	// the request waiting for the host is fetched when the host is released
+	result := make(chan error)
+	go func() {
+		_, err := client.Do(second)
+		result <- err
+	}()
+	close(done)
+	err = <-result
+	if err == nil || err.Error() != "error" {
+		t.Fatalf("expect the error of the fetch, but got %v", err)
+	}
+	if count := target.counter.(*MemoryDomainCounter).count("example.com"); count != 0 {
+		t.Fatalf("expect the host to be released, but got %d", count)
+	}
+}
+
+func TestDomainLimit_DownloaderMiddlewareRetryLater(t *testing.T) {
+	// a counter other than MemoryDomainCounter cannot tell when the host is released
+	counter := struct{ DomainCounter }{NewMemoryDomainCounter()}
+	target := NewDomainLimit(counter, 1)
+	var client arachne.HTTPClient
+	nested := 0
+	client = target.DownloaderMiddleware(arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		nested++
+		if nested == 1 {
+			_, err := client.Do(req)
+			var retryLaterErr *arachne.RetryLaterError
+			if !xerrors.As(err, &retryLaterErr) || retryLaterErr.Delay <= 0 {
+				t.Fatalf("expect RetryLaterError with a delay, but got %v", err)
+			}
+		}
+		return nil, errors.New("error")
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	for i := 0; i < 2; i++ {
+		_, err := client.Do(req)
+		if err == nil || err.Error() != "error" {
+			t.Fatalf("expect the error of the fetch, but got %v", err)
+		}
+	}
+	if nested != 2 {
+		t.Fatalf("expect 2 fetches, but got %d", nested)
 	}
 }
@@ -2,30 +2,66 @@ package resource
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 
 	"github.com/getumen/arachne"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/xerrors"
 )
 
 // RequestCounter is a request counter
 type RequestCounter struct {
 	sema *semaphore.Weighted
+	// heldKey is the key of Request.Meta that marks the requests holding the counter.
+	heldKey string
 }
 
 // NewRequestCounter creates new request counter
 func NewRequestCounter(maxRequest int64) *RequestCounter {
-	return &RequestCounter{
+	r := &RequestCounter{
 		sema: semaphore.NewWeighted(maxRequest),
 	}
+	r.heldKey = fmt.Sprintf("request_counter_%p", r)
+	return r
 }
 
 // RequestMiddleware is a request middleware
 func (r *RequestCounter) RequestMiddleware(request *arachne.Request) {
 	ctx := context.Background()
 	r.sema.Acquire(ctx, 1)
+	request.Meta[r.heldKey] = true
 }
 
-// ResponseMiddleware is a response middleware
+// ProcessRequest is a RequestMiddleware that waits for the counter until ctx is done.
+// The counter is released by ResponseMiddleware.
+func (r *RequestCounter) ProcessRequest(ctx context.Context, request *arachne.Request) (arachne.Decision, error) {
+	err := r.sema.Acquire(ctx, 1)
+	if err != nil {
+		return arachne.Decision{}, xerrors.Errorf("fail to acquire request counter: %w", err)
+	}
+	request.Meta[r.heldKey] = true
+	return arachne.Continue(), nil
+}
+
+// DownloaderMiddleware is a downloader middleware that holds the counter during the fetch.
+func (r *RequestCounter) DownloaderMiddleware(next arachne.HTTPClient) arachne.HTTPClient {
+	return arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		err := r.sema.Acquire(req.Context(), 1)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to acquire request counter: %w", err)
+		}
+		defer r.sema.Release(1)
+		return next.Do(req)
+	})
+}
+
+// ResponseMiddleware is a response middleware that releases the counter held by the request.
+// Requests that have not acquired the counter, like those dropped by an earlier middleware, are ignored.
 func (r *RequestCounter) ResponseMiddleware(response *arachne.Response) {
+	if _, ok := response.Request.Meta[r.heldKey]; !ok {
+		return
+	}
+	delete(response.Request.Meta, r.heldKey)
 	r.sema.Release(1)
 }
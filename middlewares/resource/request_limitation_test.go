@@ -1,6 +1,9 @@
 package resource
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"testing"
 
 	"github.com/getumen/arachne"
@@ -28,6 +31,7 @@ func TestRequestCounter_ResponseMiddleware(t *testing.T) {
 
 	for i := loop; i > 0; i-- {
 		r, _ := arachne.NewGetRequest("https://golang.org/")
+		r.Meta[target.heldKey] = true
 		response := &arachne.Response{
 			Request: r,
 		}
@@ -43,3 +47,73 @@ func TestRequestCounter_ResponseMiddleware(t *testing.T) {
 	// this returns error because of out of resource
 	target.sema.Release(1)
 }
+
+func TestRequestCounter_ProcessRequest(t *testing.T) {
+	target := NewRequestCounter(1)
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+
+	decision, err := target.ProcessRequest(context.Background(), r)
+	if err != nil {
+		t.Fatalf("fail to process request: %v", err)
+	}
+	if decision.Action != arachne.ActionContinue {
+		t.Fatalf("expect continue, but got %v", decision.Action)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = target.ProcessRequest(ctx, r)
+	if err == nil {
+		t.Fatalf("expect error after ctx is done, but got nil")
+	}
+}
+
+func TestRequestCounter_DownloaderMiddleware(t *testing.T) {
+	target := NewRequestCounter(1)
+	client := target.DownloaderMiddleware(arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if target.sema.TryAcquire(1) {
+			t.Fatalf("expect the counter to be held during the fetch")
+		}
+		return nil, errors.New("error")
+	}))
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://golang.org/", nil)
+		_, err := client.Do(req)
+		if err == nil {
+			t.Fatalf("expect error, but got nil")
+		}
+	}
+	// the counter is released even if the fetch fails
+	if !target.sema.TryAcquire(1) {
+		t.Fatalf("expect the counter to be released")
+	}
+}
+
+func TestRequestCounter_ResponseMiddlewareNotHeld(t *testing.T) {
+	target := NewRequestCounter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	target.sema.TryAcquire(1)
+
+	// neither a failed acquisition nor a request dropped before the counter releases it
+	failed, _ := arachne.NewGetRequest("https://golang.org/")
+	_, _ = target.ProcessRequest(ctx, failed)
+	dropped, _ := arachne.NewGetRequest("https://golang.org/")
+	for _, r := range []*arachne.Request{failed, dropped} {
+		target.ResponseMiddleware(&arachne.Response{Request: r})
+	}
+	if target.sema.TryAcquire(1) {
+		t.Fatalf("expected the counter to be kept")
+	}
+
+	// the counter is released once
+	target.sema.Release(1)
+	held, _ := arachne.NewGetRequest("https://golang.org/")
+	target.RequestMiddleware(held)
+	target.ResponseMiddleware(&arachne.Response{Request: held})
+	target.ResponseMiddleware(&arachne.Response{Request: held})
+	if !target.sema.TryAcquire(1) {
+		t.Fatalf("expected the counter to be released")
+	}
+}
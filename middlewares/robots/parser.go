@@ -0,0 +1,167 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots is the group of robots.txt rules for a user agent.
+type Robots struct {
+	rules      []rule
+	crawlDelay time.Duration
+	hasDelay   bool
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	agents []string
+	rules  []rule
+	delay  string
+}
+
+// AllowAll is Robots without rules.
+var AllowAll = &Robots{}
+
+// Parse parses robots.txt and returns the rules of the group for userAgent.
+// The group whose User-agent equals the product token of userAgent is used, and the group of * otherwise.
+func Parse(body []byte, userAgent string) *Robots {
+	groups := parseGroups(body)
+	token := productToken(userAgent)
+
+	robots := &Robots{}
+	found := false
+	for _, wildcard := range []bool{false, true} {
+		for _, g := range groups {
+			if !g.matches(token, wildcard) {
+				continue
+			}
+			found = true
+			robots.rules = append(robots.rules, g.rules...)
+			if delay, err := strconv.ParseFloat(g.delay, 64); err == nil && delay >= 0 && !robots.hasDelay {
+				robots.crawlDelay = time.Duration(delay * float64(time.Second))
+				robots.hasDelay = true
+			}
+		}
+		if found {
+			break
+		}
+	}
+	return robots
+}
+
+func parseGroups(body []byte) []*group {
+	groups := make([]*group, 0)
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			// an empty Disallow allows everything
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if current != nil {
+				current.delay = value
+			}
+		}
+	}
+	return groups
+}
+
+func (g *group) matches(token string, wildcard bool) bool {
+	for _, agent := range g.agents {
+		if wildcard && agent == "*" || !wildcard && agent == token {
+			return true
+		}
+	}
+	return false
+}
+
+// productToken returns the name of userAgent like "examplebot" of "ExampleBot/1.0 (+https://example.com/)".
+func productToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// Allowed reports whether the path, including the query, may be fetched.
+// The longest matching rule wins, and Allow wins a tie.
+func (r *Robots) Allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || len(rule.pattern) == longest && rule.allow {
+			allowed = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay of the group.
+func (r *Robots) CrawlDelay() (time.Duration, bool) {
+	return r.crawlDelay, r.hasDelay
+}
+
+// match matches path with pattern where * matches any sequence and a trailing $ matches the end.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return len(path)-len(part) >= pos && strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
@@ -0,0 +1,85 @@
+package robots
+
+import (
+	"testing"
+	"time"
+)
+
+const robotsTxt = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Crawl-delay: 5
+
+User-agent: ExampleBot
+User-agent: OtherBot
+Disallow: /*.pdf$
+Disallow: /search?q=*&page=
+Allow: /
+Crawl-delay: 0.5
+`
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{"AnyBot/1.0", "/", true},
+		{"AnyBot/1.0", "/private/", false},
+		{"AnyBot/1.0", "/private/page", false},
+		{"AnyBot/1.0", "/private/public/page", true},
+		{"AnyBot/1.0", "/robots.txt", true},
+		{"ExampleBot/1.0 (+https://example.com/)", "/private/", true},
+		{"examplebot", "/paper.pdf", false},
+		{"examplebot", "/paper.pdf?download", true},
+		{"examplebot", "/search?q=go&page=2", false},
+		{"examplebot", "/search?q=go", true},
+		{"otherbot", "/paper.pdf", false},
+	} {
+		actual := Parse([]byte(robotsTxt), c.userAgent).Allowed(c.path)
+		if actual != c.expected {
+			t.Fatalf("%s %s: expect %v, but got %v", c.userAgent, c.path, c.expected, actual)
+		}
+	}
+}
+
+func TestParse_CrawlDelay(t *testing.T) {
+	delay, ok := Parse([]byte(robotsTxt), "AnyBot").CrawlDelay()
+	if !ok || delay != 5*time.Second {
+		t.Fatalf("expect %v, but got %v", 5*time.Second, delay)
+	}
+	delay, ok = Parse([]byte(robotsTxt), "ExampleBot").CrawlDelay()
+	if !ok || delay != 500*time.Millisecond {
+		t.Fatalf("expect %v, but got %v", 500*time.Millisecond, delay)
+	}
+	_, ok = Parse([]byte("User-agent: *\nDisallow:\n"), "AnyBot").CrawlDelay()
+	if ok {
+		t.Fatalf("expect no crawl delay")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+	} {
+		actual := match(c.pattern, c.path)
+		if actual != c.expected {
+			t.Fatalf("%s %s: expect %v, but got %v", c.pattern, c.path, c.expected, actual)
+		}
+	}
+}
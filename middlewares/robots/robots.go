@@ -0,0 +1,169 @@
+package robots
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// maxBodySize is the size of robots.txt that is read.
+const maxBodySize = 512 * 1024
+
+// Middleware is a RequestMiddleware that drops requests disallowed by robots.txt.
+// robots.txt is fetched once per host through the HTTPClient and cached for the TTL.
+type Middleware struct {
+	client     arachne.HTTPClient
+	userAgent  string
+	ttl        time.Duration
+	retryDelay time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+type entry struct {
+	ready     chan struct{}
+	fetched   bool
+	robots    *Robots
+	err       error
+	expiresAt time.Time
+}
+
+// NewMiddleware creates Middleware that follows the rules for userAgent and fetches robots.txt again after ttl.
+// userAgent is also sent as the User-Agent header of the robots.txt requests.
+func NewMiddleware(client arachne.HTTPClient, userAgent string, ttl time.Duration) *Middleware {
+	return &Middleware{
+		client:     client,
+		userAgent:  userAgent,
+		ttl:        ttl,
+		retryDelay: time.Minute,
+		entries:    map[string]*entry{},
+		now:        time.Now,
+	}
+}
+
+// SetRetryDelay sets how long requests wait when robots.txt of their host is unavailable
+// because of a server error or a network error. The default is a minute.
+func (m *Middleware) SetRetryDelay(retryDelay time.Duration) *Middleware {
+	m.retryDelay = retryDelay
+	return m
+}
+
+// ProcessRequest drops the request if robots.txt of its host disallows it.
+// The request is retried later while robots.txt is unavailable.
+func (m *Middleware) ProcessRequest(ctx context.Context, request *arachne.Request) (arachne.Decision, error) {
+	requestURL, err := url.Parse(request.URL)
+	if err != nil {
+		return arachne.Decision{}, xerrors.Errorf("fail to parse url %s: %w", request.URL, err)
+	}
+	robots, err := m.robots(ctx, requestURL)
+	if err != nil {
+		return arachne.Decision{}, err
+	}
+	if robots == nil {
+		return arachne.RetryLater(m.retryDelay), nil
+	}
+	if !robots.Allowed(requestURL.RequestURI()) {
+		return arachne.Drop(), nil
+	}
+	return arachne.Continue(), nil
+}
+
+// CrawlDelay returns Crawl-delay of the cached robots.txt of host, for rate limiters to use.
+// host is the host of the request URL including the port if any.
+func (m *Middleware) CrawlDelay(host string) (time.Duration, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	e, ok := m.entries[host]
+	if !ok || !e.fetched || e.robots == nil {
+		return 0, false
+	}
+	return e.robots.CrawlDelay()
+}
+
+// robots returns the rules of the host of requestURL, or nil if robots.txt is unavailable.
+func (m *Middleware) robots(ctx context.Context, requestURL *url.URL) (*Robots, error) {
+	m.mutex.Lock()
+	e, ok := m.entries[requestURL.Host]
+	if !ok || e.fetched && !m.now().Before(e.expiresAt) {
+		e = &entry{ready: make(chan struct{})}
+		m.entries[requestURL.Host] = e
+		m.mutex.Unlock()
+		m.fetch(ctx, requestURL, e)
+	} else {
+		m.mutex.Unlock()
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, xerrors.Errorf("fail to wait for robots.txt of %s: %w", requestURL.Host, ctx.Err())
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.robots, nil
+}
+
+// fetch fetches robots.txt into e and closes e.ready.
+func (m *Middleware) fetch(ctx context.Context, requestURL *url.URL, e *entry) {
+	robots, ttl, err := m.get(ctx, requestURL)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err != nil {
+		// the request is aborted, so let the next request fetch it again
+		if m.entries[requestURL.Host] == e {
+			delete(m.entries, requestURL.Host)
+		}
+		e.err = err
+	} else {
+		e.robots = robots
+		e.fetched = true
+		e.expiresAt = m.now().Add(ttl)
+	}
+	close(e.ready)
+}
+
+// get fetches robots.txt of the host of requestURL and returns the rules and how long they are cached.
+// The error is only returned when ctx is done.
+func (m *Middleware) get(ctx context.Context, requestURL *url.URL) (*Robots, time.Duration, error) {
+	robotsURL := url.URL{Scheme: requestURL.Scheme, Host: requestURL.Host, Path: "/robots.txt"}
+	httpRequest, err := http.NewRequest(http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, m.retryDelay, nil
+	}
+	httpRequest.Header.Set("User-Agent", m.userAgent)
+
+	httpResponse, err := m.client.Do(httpRequest.WithContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		return nil, 0, xerrors.Errorf("fail to fetch %s: %w", robotsURL.String(), ctx.Err())
+	} else if err != nil {
+		return nil, m.retryDelay, nil
+	}
+	if httpResponse.Body == nil {
+		httpResponse.Body = http.NoBody
+	}
+	defer httpResponse.Body.Close()
+
+	switch {
+	case httpResponse.StatusCode >= 500:
+		return nil, m.retryDelay, nil
+	case httpResponse.StatusCode >= 300:
+		// 4xx and redirects that the client does not follow allow everything
+		return AllowAll, m.ttl, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxBodySize))
+	if err != nil {
+		return nil, m.retryDelay, nil
+	}
+	return Parse(body, m.userAgent), m.ttl, nil
+}
@@ -0,0 +1,116 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func newTestClient(statusCode int, body string, fetches *int64) arachne.HTTPClient {
+	return arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt64(fetches, 1)
+		if req.URL.Path != "/robots.txt" {
+			return nil, errors.New("unexpected request " + req.URL.String())
+		}
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+}
+
+func TestMiddleware_ProcessRequest(t *testing.T) {
+	var fetches int64
+	target := NewMiddleware(newTestClient(200, robotsTxt, &fetches), "AnyBot/1.0", time.Hour)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := arachne.NewGetRequest("https://example.com/private/page")
+			decision, err := target.ProcessRequest(context.Background(), request)
+			if err != nil {
+				t.Errorf("fail to process request: %v", err)
+			} else if decision.Action != arachne.ActionDrop {
+				t.Errorf("expect drop, but got %v", decision.Action)
+			}
+		}()
+	}
+	wg.Wait()
+
+	request, _ := arachne.NewGetRequest("https://example.com/")
+	decision, err := target.ProcessRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("fail to process request: %v", err)
+	}
+	if decision.Action != arachne.ActionContinue {
+		t.Fatalf("expect continue, but got %v", decision.Action)
+	}
+	if fetches != 1 {
+		t.Fatalf("expect robots.txt to be fetched once, but got %d", fetches)
+	}
+
+	delay, ok := target.CrawlDelay("example.com")
+	if !ok || delay != 5*time.Second {
+		t.Fatalf("expect crawl delay %v, but got %v", 5*time.Second, delay)
+	}
+}
+
+func TestMiddleware_TTL(t *testing.T) {
+	var fetches int64
+	target := NewMiddleware(newTestClient(200, robotsTxt, &fetches), "AnyBot/1.0", time.Hour)
+	now := time.Now()
+	target.now = func() time.Time { return now }
+
+	request, _ := arachne.NewGetRequest("https://example.com/")
+	for i := 0; i < 2; i++ {
+		_, _ = target.ProcessRequest(context.Background(), request)
+	}
+	now = now.Add(time.Hour)
+	_, _ = target.ProcessRequest(context.Background(), request)
+
+	if fetches != 2 {
+		t.Fatalf("expect robots.txt to be fetched twice, but got %d", fetches)
+	}
+}
+
+func TestMiddleware_Unavailable(t *testing.T) {
+	var fetches int64
+	request, _ := arachne.NewGetRequest("https://example.com/private/page")
+
+	target := NewMiddleware(newTestClient(404, "", &fetches), "AnyBot/1.0", time.Hour)
+	decision, _ := target.ProcessRequest(context.Background(), request)
+	if decision.Action != arachne.ActionContinue {
+		t.Fatalf("expect 404 to allow everything, but got %v", decision.Action)
+	}
+
+	target = NewMiddleware(newTestClient(503, "", &fetches), "AnyBot/1.0", time.Hour).SetRetryDelay(time.Second)
+	decision, _ = target.ProcessRequest(context.Background(), request)
+	if decision.Action != arachne.ActionRetryLater || decision.Delay != time.Second {
+		t.Fatalf("expect retry after %v, but got %v", time.Second, decision)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	target = NewMiddleware(newTestClient(200, robotsTxt, &fetches), "AnyBot/1.0", time.Hour)
+	target.client = arachne.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+	_, err := target.ProcessRequest(ctx, request)
+	if err == nil {
+		t.Fatalf("expect error after ctx is done, but got nil")
+	}
+	if _, ok := target.entries["example.com"]; ok {
+		t.Fatalf("expect the aborted fetch not to be cached")
+	}
+}
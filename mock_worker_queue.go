@@ -33,6 +33,34 @@ func (m *MockWorkerQueue) EXPECT() *MockWorkerQueueMockRecorder {
 	return m.recorder
 }
 
+// PublishRequest mocks base method
+func (m *MockWorkerQueue) PublishRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishRequest indicates an expected call of PublishRequest
+func (mr *MockWorkerQueueMockRecorder) PublishRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRequest", reflect.TypeOf((*MockWorkerQueue)(nil).PublishRequest), request)
+}
+
+// RetryRequest mocks base method
+func (m *MockWorkerQueue) RetryRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryRequest indicates an expected call of RetryRequest
+func (mr *MockWorkerQueueMockRecorder) RetryRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryRequest", reflect.TypeOf((*MockWorkerQueue)(nil).RetryRequest), request)
+}
+
 // SubscribeRequests mocks base method
 func (m *MockWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *Request, error) {
 	m.ctrl.T.Helper()
@@ -48,8 +76,73 @@ func (mr *MockWorkerQueueMockRecorder) SubscribeRequests(ctx interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeRequests", reflect.TypeOf((*MockWorkerQueue)(nil).SubscribeRequests), ctx)
 }
 
+// MockAckingWorkerQueue is a mock of AckingWorkerQueue interface
+type MockAckingWorkerQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockAckingWorkerQueueMockRecorder
+}
+
+// MockAckingWorkerQueueMockRecorder is the mock recorder for MockAckingWorkerQueue
+type MockAckingWorkerQueueMockRecorder struct {
+	mock *MockAckingWorkerQueue
+}
+
+// NewMockAckingWorkerQueue creates a new mock instance
+func NewMockAckingWorkerQueue(ctrl *gomock.Controller) *MockAckingWorkerQueue {
+	mock := &MockAckingWorkerQueue{ctrl: ctrl}
+	mock.recorder = &MockAckingWorkerQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAckingWorkerQueue) EXPECT() *MockAckingWorkerQueueMockRecorder {
+	return m.recorder
+}
+
+// Ack mocks base method
+func (m *MockAckingWorkerQueue) Ack(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ack", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack
+func (mr *MockAckingWorkerQueueMockRecorder) Ack(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*MockAckingWorkerQueue)(nil).Ack), request)
+}
+
+// Nack mocks base method
+func (m *MockAckingWorkerQueue) Nack(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Nack", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Nack indicates an expected call of Nack
+func (mr *MockAckingWorkerQueueMockRecorder) Nack(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockAckingWorkerQueue)(nil).Nack), request)
+}
+
+// PublishRequest mocks base method
+func (m *MockAckingWorkerQueue) PublishRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishRequest indicates an expected call of PublishRequest
+func (mr *MockAckingWorkerQueueMockRecorder) PublishRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRequest", reflect.TypeOf((*MockAckingWorkerQueue)(nil).PublishRequest), request)
+}
+
 // RetryRequest mocks base method
-func (m *MockWorkerQueue) RetryRequest(request *Request) error {
+func (m *MockAckingWorkerQueue) RetryRequest(request *Request) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "RetryRequest", request)
 	ret0, _ := ret[0].(error)
@@ -57,13 +150,95 @@ func (m *MockWorkerQueue) RetryRequest(request *Request) error {
 }
 
 // RetryRequest indicates an expected call of RetryRequest
-func (mr *MockWorkerQueueMockRecorder) RetryRequest(request interface{}) *gomock.Call {
+func (mr *MockAckingWorkerQueueMockRecorder) RetryRequest(request interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryRequest", reflect.TypeOf((*MockWorkerQueue)(nil).RetryRequest), request)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryRequest", reflect.TypeOf((*MockAckingWorkerQueue)(nil).RetryRequest), request)
+}
+
+// SubscribeRequests mocks base method
+func (m *MockAckingWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeRequests", ctx)
+	ret0, _ := ret[0].(<-chan *Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeRequests indicates an expected call of SubscribeRequests
+func (mr *MockAckingWorkerQueueMockRecorder) SubscribeRequests(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeRequests", reflect.TypeOf((*MockAckingWorkerQueue)(nil).SubscribeRequests), ctx)
+}
+
+// MockDeadLetterQueue is a mock of DeadLetterQueue interface
+type MockDeadLetterQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterQueueMockRecorder
+}
+
+// MockDeadLetterQueueMockRecorder is the mock recorder for MockDeadLetterQueue
+type MockDeadLetterQueueMockRecorder struct {
+	mock *MockDeadLetterQueue
+}
+
+// NewMockDeadLetterQueue creates a new mock instance
+func NewMockDeadLetterQueue(ctrl *gomock.Controller) *MockDeadLetterQueue {
+	mock := &MockDeadLetterQueue{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDeadLetterQueue) EXPECT() *MockDeadLetterQueueMockRecorder {
+	return m.recorder
+}
+
+// DeadLetter mocks base method
+func (m *MockDeadLetterQueue) DeadLetter(fingerprint string) (*DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetter", fingerprint)
+	ret0, _ := ret[0].(*DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetter indicates an expected call of DeadLetter
+func (mr *MockDeadLetterQueueMockRecorder) DeadLetter(fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetter", reflect.TypeOf((*MockDeadLetterQueue)(nil).DeadLetter), fingerprint)
+}
+
+// DeadLetters mocks base method
+func (m *MockDeadLetterQueue) DeadLetters() ([]*DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetters")
+	ret0, _ := ret[0].([]*DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetters indicates an expected call of DeadLetters
+func (mr *MockDeadLetterQueueMockRecorder) DeadLetters() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetters", reflect.TypeOf((*MockDeadLetterQueue)(nil).DeadLetters))
+}
+
+// PublishDeadLetter mocks base method
+func (m *MockDeadLetterQueue) PublishDeadLetter(letter *DeadLetter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishDeadLetter", letter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishDeadLetter indicates an expected call of PublishDeadLetter
+func (mr *MockDeadLetterQueueMockRecorder) PublishDeadLetter(letter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishDeadLetter", reflect.TypeOf((*MockDeadLetterQueue)(nil).PublishDeadLetter), letter)
 }
 
 // PublishRequest mocks base method
-func (m *MockWorkerQueue) PublishRequest(request *Request) error {
+func (m *MockDeadLetterQueue) PublishRequest(request *Request) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "PublishRequest", request)
 	ret0, _ := ret[0].(error)
@@ -71,7 +246,131 @@ func (m *MockWorkerQueue) PublishRequest(request *Request) error {
 }
 
 // PublishRequest indicates an expected call of PublishRequest
-func (mr *MockWorkerQueueMockRecorder) PublishRequest(request interface{}) *gomock.Call {
+func (mr *MockDeadLetterQueueMockRecorder) PublishRequest(request interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRequest", reflect.TypeOf((*MockWorkerQueue)(nil).PublishRequest), request)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRequest", reflect.TypeOf((*MockDeadLetterQueue)(nil).PublishRequest), request)
+}
+
+// ReinjectDeadLetter mocks base method
+func (m *MockDeadLetterQueue) ReinjectDeadLetter(fingerprint string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReinjectDeadLetter", fingerprint)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReinjectDeadLetter indicates an expected call of ReinjectDeadLetter
+func (mr *MockDeadLetterQueueMockRecorder) ReinjectDeadLetter(fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReinjectDeadLetter", reflect.TypeOf((*MockDeadLetterQueue)(nil).ReinjectDeadLetter), fingerprint)
+}
+
+// RetryRequest mocks base method
+func (m *MockDeadLetterQueue) RetryRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryRequest indicates an expected call of RetryRequest
+func (mr *MockDeadLetterQueueMockRecorder) RetryRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryRequest", reflect.TypeOf((*MockDeadLetterQueue)(nil).RetryRequest), request)
+}
+
+// SubscribeRequests mocks base method
+func (m *MockDeadLetterQueue) SubscribeRequests(ctx context.Context) (<-chan *Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeRequests", ctx)
+	ret0, _ := ret[0].(<-chan *Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeRequests indicates an expected call of SubscribeRequests
+func (mr *MockDeadLetterQueueMockRecorder) SubscribeRequests(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeRequests", reflect.TypeOf((*MockDeadLetterQueue)(nil).SubscribeRequests), ctx)
+}
+
+// MockInspectableWorkerQueue is a mock of InspectableWorkerQueue interface
+type MockInspectableWorkerQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockInspectableWorkerQueueMockRecorder
+}
+
+// MockInspectableWorkerQueueMockRecorder is the mock recorder for MockInspectableWorkerQueue
+type MockInspectableWorkerQueueMockRecorder struct {
+	mock *MockInspectableWorkerQueue
+}
+
+// NewMockInspectableWorkerQueue creates a new mock instance
+func NewMockInspectableWorkerQueue(ctrl *gomock.Controller) *MockInspectableWorkerQueue {
+	mock := &MockInspectableWorkerQueue{ctrl: ctrl}
+	mock.recorder = &MockInspectableWorkerQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockInspectableWorkerQueue) EXPECT() *MockInspectableWorkerQueueMockRecorder {
+	return m.recorder
+}
+
+// PendingRequests mocks base method
+func (m *MockInspectableWorkerQueue) PendingRequests() ([]*Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PendingRequests")
+	ret0, _ := ret[0].([]*Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PendingRequests indicates an expected call of PendingRequests
+func (mr *MockInspectableWorkerQueueMockRecorder) PendingRequests() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingRequests", reflect.TypeOf((*MockInspectableWorkerQueue)(nil).PendingRequests))
+}
+
+// PublishRequest mocks base method
+func (m *MockInspectableWorkerQueue) PublishRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishRequest indicates an expected call of PublishRequest
+func (mr *MockInspectableWorkerQueueMockRecorder) PublishRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishRequest", reflect.TypeOf((*MockInspectableWorkerQueue)(nil).PublishRequest), request)
+}
+
+// RetryRequest mocks base method
+func (m *MockInspectableWorkerQueue) RetryRequest(request *Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryRequest indicates an expected call of RetryRequest
+func (mr *MockInspectableWorkerQueueMockRecorder) RetryRequest(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryRequest", reflect.TypeOf((*MockInspectableWorkerQueue)(nil).RetryRequest), request)
+}
+
+// SubscribeRequests mocks base method
+func (m *MockInspectableWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeRequests", ctx)
+	ret0, _ := ret[0].(<-chan *Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeRequests indicates an expected call of SubscribeRequests
+func (mr *MockInspectableWorkerQueueMockRecorder) SubscribeRequests(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeRequests", reflect.TypeOf((*MockInspectableWorkerQueue)(nil).SubscribeRequests), ctx)
 }
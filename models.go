@@ -7,19 +7,35 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"golang.org/x/xerrors"
 )
 
 // Request is a domain model that represents http request.
 type Request struct {
-	URL        string
-	Method     string
-	Header     http.Header
-	Body       []byte
-	Priority   int64
-	QueueName  string
-	Meta       map[string]interface{}
+	URL       string
+	Method    string
+	Header    http.Header
+	Body      []byte
+	Priority  int64
+	QueueName string
+	// Meta is carried with the request through the pipeline.
+	// Worker uses the keys "retry", "error" and "status_code".
+	Meta map[string]interface{}
+	// Attempts is the number of times the request has been retried.
+	Attempts int
+	// NotBefore is the time before which the request should not be fetched. The zero value means no restriction.
+	NotBefore time.Time
+	// Depth is the number of links followed from the seed request, whose Depth is 0.
+	Depth int
+	// Referer is the url of the request whose response links to the request, or empty for a seed request.
+	Referer string
+	// SeedID identifies the seed request the request is found from. It is the url of the seed unless set explicitly.
+	SeedID string
+	// Callback and Errback are the names of the handlers in CallbackRegistry for the response of the request.
+	Callback   string
+	Errback    string
 	requestURL *url.URL
 }
 
@@ -84,9 +100,66 @@ func (r *Request) HTTPRequest() (*http.Request, error) {
 	return o, nil
 }
 
+// clone returns a copy of the request whose Header, Body and Meta can be modified independently.
+func (r *Request) clone() *Request {
+	o := new(Request)
+	*o = *r
+	o.Header = http.Header{}
+	for key, values := range r.Header {
+		o.Header[key] = append([]string(nil), values...)
+	}
+	o.Body = append([]byte(nil), r.Body...)
+	o.Meta = make(map[string]interface{}, len(r.Meta))
+	for key, value := range r.Meta {
+		o.Meta[key] = value
+	}
+	return o
+}
+
+// lastFailure returns the status code and the error of the last failed attempt
+// kept in Request.Meta["status_code"] and Request.Meta["error"], if any.
+func (r *Request) lastFailure() (int, string) {
+	var statusCode int
+	switch code := r.Meta["status_code"].(type) {
+	case int:
+		statusCode = code
+	case float64:
+		// decoded from JSON
+		statusCode = int(code)
+	}
+	cause, _ := r.Meta["error"].(string)
+	return statusCode, cause
+}
+
+// isRetry reports whether the request is flagged to be retried by Request.Meta["retry"].
+func (r *Request) isRetry() bool {
+	retry, ok := r.Meta["retry"].(bool)
+	return ok && retry
+}
+
+// SetParent records that the request is found in the response of parent.
+// It sets Depth, Referer and SeedID from parent.
+func (r *Request) SetParent(parent *Request) {
+	r.Depth = parent.Depth + 1
+	r.Referer = parent.URL
+	r.SeedID = parent.SeedID
+	if r.SeedID == "" {
+		r.SeedID = parent.URL
+	}
+}
+
 // URLHost returns the host of the request url.
+// The url is parsed on demand if the request is not built by the constructors or the decoders,
+// and the host is empty if the url is invalid.
 func (r *Request) URLHost() string {
-	return r.requestURL.Host
+	if r.requestURL != nil {
+		return r.requestURL.Host
+	}
+	requestURL, err := url.Parse(r.URL)
+	if err != nil {
+		return ""
+	}
+	return requestURL.Host
 }
 
 // BodyReader returns io.Reader of Body
@@ -95,11 +168,14 @@ func (r *Request) BodyReader() io.Reader {
 }
 
 // Response is a domain model that represents http response.
+// Request is the request of the fetched url, which differs from the subscribed request after redirects.
 type Response struct {
 	StatusCode int
 	Headers    http.Header
 	Body       []byte
 	Request    *Request
+	// subscribed is the request subscribed from the WorkerQueue, or nil if it is Request.
+	subscribed *Request
 }
 
 // NewResponseFromHTTPResponse constructs Response from http.Response
@@ -123,6 +199,35 @@ func NewResponseFromHTTPResponse(response *http.Response) (*Response, error) {
 	return r, nil
 }
 
+// setSubscribed records the subscribed request of the response for the WorkerQueue,
+// and carries its Meta and the other fields that are not about the fetched url over to Request.
+func (r *Response) setSubscribed(request *Request) {
+	if r.Request == nil || r.Request == request {
+		r.Request = request
+		return
+	}
+	r.subscribed = request
+	r.Request.Priority = request.Priority
+	r.Request.QueueName = request.QueueName
+	// the Meta is shared so that the pairs of RequestMiddlewares and ResponseMiddlewares see the same values.
+	r.Request.Meta = request.Meta
+	r.Request.Attempts = request.Attempts
+	r.Request.NotBefore = request.NotBefore
+	r.Request.Depth = request.Depth
+	r.Request.Referer = request.Referer
+	r.Request.SeedID = request.SeedID
+	r.Request.Callback = request.Callback
+	r.Request.Errback = request.Errback
+}
+
+// subscribedRequest returns the request subscribed from the WorkerQueue.
+func (r *Response) subscribedRequest() *Request {
+	if r.subscribed != nil {
+		return r.subscribed
+	}
+	return r.Request
+}
+
 // Follow creates a url whose url schema and host is the same as those of response.
 func (r *Response) Follow(urlString string) (string, error) {
 	requestURL, err := url.Parse(r.Request.URL)
@@ -143,6 +248,7 @@ func (r *Response) Follow(urlString string) (string, error) {
 }
 
 // FollowRequest creates a simple GET request whose the schema and the host of the url is the same as those of response.
+// The request is a child of the request of the response. See Request.SetParent.
 func (r *Response) FollowRequest(urlString string) (*Request, error) {
 	requestURL, err := r.Follow(urlString)
 	if err != nil {
@@ -152,6 +258,7 @@ func (r *Response) FollowRequest(urlString string) (*Request, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("fail to make request.: %w", err)
 	}
+	req.SetParent(r.Request)
 	return req, nil
 }
 
@@ -11,20 +11,22 @@ func TestResponse_Follow(t *testing.T) {
 		t.Fatalf("fail to create request")
 	}
 	validResponse := Response{
-		200,
-		http.Header{},
-		[]byte{},
-		request}
+		StatusCode: 200,
+		Headers:    http.Header{},
+		Body:       []byte{},
+		Request:    request,
+	}
 
 	request, err = NewGetRequest("gopher")
 	if err != nil {
 		t.Fatalf("fail to create request")
 	}
 	invalidResponse := Response{
-		200,
-		http.Header{},
-		[]byte{},
-		request}
+		StatusCode: 200,
+		Headers:    http.Header{},
+		Body:       []byte{},
+		Request:    request,
+	}
 
 	tests := []struct {
 		response        Response
@@ -44,3 +46,28 @@ func TestResponse_Follow(t *testing.T) {
 		}
 	}
 }
+
+func TestResponse_FollowRequest(t *testing.T) {
+	seed, err := NewGetRequest("https://golang.org/")
+	if err != nil {
+		t.Fatalf("fail to create request")
+	}
+	response := &Response{StatusCode: 200, Headers: http.Header{}, Body: []byte{}, Request: seed}
+
+	child, err := response.FollowRequest("/doc/")
+	if err != nil {
+		t.Fatalf("fail to follow: %v", err)
+	}
+	if child.Depth != 1 || child.Referer != "https://golang.org/" || child.SeedID != "https://golang.org/" {
+		t.Fatalf("unexpected parent link: depth %d, referer %s, seed %s", child.Depth, child.Referer, child.SeedID)
+	}
+
+	grandchild, err := (&Response{StatusCode: 200, Headers: http.Header{}, Body: []byte{}, Request: child}).FollowRequest("/doc/install")
+	if err != nil {
+		t.Fatalf("fail to follow: %v", err)
+	}
+	if grandchild.Depth != 2 || grandchild.Referer != "https://golang.org/doc/" || grandchild.SeedID != "https://golang.org/" {
+		t.Fatalf("unexpected parent link: depth %d, referer %s, seed %s",
+			grandchild.Depth, grandchild.Referer, grandchild.SeedID)
+	}
+}
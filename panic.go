@@ -0,0 +1,77 @@
+package arachne
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a panic recovered in a stage of Worker.
+type PanicError struct {
+	// Stage is the name of the stage: "fetch", "spider", "item pipeline" or "publish".
+	Stage string
+	// Request is the request processed by the stage, or nil.
+	Request *Request
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.Request == nil {
+		return fmt.Sprintf("panic in %s: %v", e.Stage, e.Value)
+	}
+	return fmt.Sprintf("panic in %s of %s: %v", e.Stage, e.Request.URL, e.Value)
+}
+
+// supervise calls f and recovers a panic in it.
+// A recovered panic is logged, attached to Request.Meta["error"], and reported to Worker.OnPanic.
+// Unless Worker.RestartOnPanic is true, it stops the worker as well.
+func (w *Worker) supervise(stage string, request *Request, f func()) (panicErr *PanicError) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		panicErr = &PanicError{
+			Stage:   stage,
+			Request: request,
+			Value:   value,
+			Stack:   debug.Stack(),
+		}
+		w.handlePanic(panicErr)
+	}()
+	f()
+	return nil
+}
+
+func (w *Worker) handlePanic(panicErr *PanicError) {
+	w.Logger.Errorf("%v\n%s", panicErr, panicErr.Stack)
+	if panicErr.Request != nil {
+		if panicErr.Request.Meta == nil {
+			panicErr.Request.Meta = map[string]interface{}{}
+		}
+		panicErr.Request.Meta["error"] = panicErr.Error()
+	}
+	if w.OnPanic != nil {
+		w.OnPanic(panicErr)
+	}
+	if w.RestartOnPanic {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.panicErr == nil {
+		w.panicErr = panicErr
+	}
+	if w.stop != nil {
+		w.stop()
+	}
+}
+
+// giveUp sends the request whose fetch panicked to the dead letter queue and acks it
+// because it would panic again.
+func (w *Worker) giveUp(request *Request, panicErr *PanicError) {
+	w.deadLetter(request, 0, panicErr.Error())
+	w.acknowledge(request, true)
+}
@@ -0,0 +1,117 @@
+package arachne
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/xerrors"
+)
+
+func TestWorker_PanicStopsWorker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Errorf(gomock.Any(), gomock.Any()).Times(1)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock := NewMockDeadLetterQueue(ctrl)
+	workerQueueMock.EXPECT().SubscribeRequests(gomock.Any()).DoAndReturn(
+		func(ctx context.Context) (<-chan *Request, error) {
+			ch := make(chan *Request)
+			go func() {
+				defer close(ch)
+				ch <- request
+				<-ctx.Done()
+			}()
+			return ch, nil
+		},
+	)
+	loggerMock.EXPECT().Infof(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock.EXPECT().PublishDeadLetter(gomock.Any()).DoAndReturn(
+		func(letter *DeadLetter) error {
+			if letter.Request != request {
+				t.Fatalf("expected the panicking request, but got %s", letter.Request.URL)
+			}
+			return nil
+		},
+	)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){
+			func(request *Request) {
+				panic("broken middleware")
+			},
+		},
+		[]func(response *Response){},
+		nil,
+	)
+	reported := make([]*PanicError, 0)
+	worker.OnPanic = func(err *PanicError) {
+		reported = append(reported, err)
+	}
+
+	err := worker.Start(context.Background())
+	panicErr := &PanicError{}
+	if !xerrors.As(err, &panicErr) || panicErr.Stage != "fetch" || panicErr.Value != "broken middleware" {
+		t.Fatalf("expected the panic in fetch, but got %v", err)
+	}
+	if len(reported) != 1 || reported[0] != panicErr {
+		t.Fatalf("expected the panic to be reported, but got %v", reported)
+	}
+	if request.Meta["error"] != panicErr.Error() {
+		t.Fatalf("expected the panic to be attached to the request, but got %v", request.Meta["error"])
+	}
+}
+
+func TestWorker_RestartOnPanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Errorf(gomock.Any(), gomock.Any()).Times(2)
+
+	worker := newWorker(
+		nil,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		func(response *Response) ([]*Request, error) {
+			if response.Request.URL == "https://golang.org/panic" {
+				panic("broken spider")
+			}
+			return []*Request{response.Request}, nil
+		},
+	)
+	worker.ItemPipelines = []ItemPipeline{
+		ItemPipelineFunc(func(item Item, response *Response) (Item, error) {
+			panic("broken pipeline")
+		}),
+	}
+	worker.ItemSpider = func(response *Response) (*SpiderOutput, error) {
+		requests, err := worker.Spider(response)
+		return &SpiderOutput{Requests: requests, Items: []Item{{}}}, err
+	}
+	worker.RestartOnPanic = true
+
+	responseChan := make(chan *Response, 2)
+	responseChan <- &Response{Request: &Request{URL: "https://golang.org/panic"}}
+	responseChan <- &Response{Request: &Request{URL: "https://golang.org/"}}
+	close(responseChan)
+
+	resultChan, _ := worker.applySpider(responseChan)
+	results := make([]*spiderResult, 0)
+	for result := range resultChan {
+		results = append(results, result)
+	}
+	if len(results) != 2 || len(results[0].requests) != 0 || len(results[1].requests) != 1 {
+		t.Fatalf("expected the spider to go on after the panic, but got %v", results)
+	}
+}
@@ -0,0 +1,300 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getumen/arachne"
+	"github.com/streadway/amqp"
+	"golang.org/x/xerrors"
+)
+
+// amqpMaxPriority is the x-max-priority argument of declared queues.
+const amqpMaxPriority = 9
+
+// amqpDelaySuffix is appended to the name of a queue to name its delay queue.
+const amqpDelaySuffix = ".delay"
+
+// AMQPChannel is the subset of *amqp.Channel that the AMQP WorkerQueue uses.
+// Tests can replace it with an in-process stand-in instead of a broker.
+type AMQPChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+}
+
+type amqpWorkerQueue struct {
+	channel     AMQPChannel
+	queueNames  []string
+	mutex       sync.Mutex
+	declared    map[string]bool
+	consumerSeq int
+	deliveries  map[*arachne.Request]amqp.Delivery
+}
+
+// NewAMQPWorkerQueue returns RabbitMQ WorkerQueue implementation.
+// Requests are published to the queue named by Request.QueueName through the default exchange,
+// and SubscribeRequests consumes queueNames ("default" if none is given) with manual acks.
+// The returned queue implements arachne.AckingWorkerQueue, and a delivery is acked when its request is acked.
+// A request whose Request.NotBefore is in the future is published to the delay queue of its queue,
+// named with the ".delay" suffix, with a per-message TTL until then,
+// and the broker dead-letters it to its queue when the TTL expires.
+// The broker expires only the messages at the head of a queue,
+// so a request may wait for the requests with a longer delay that are published before it.
+// Unacked deliveries are delivered again by the broker when the channel is closed.
+// Set the prefetch count of the channel with Qos to bound unacked deliveries.
+func NewAMQPWorkerQueue(channel AMQPChannel, queueNames ...string) (arachne.WorkerQueue, error) {
+	if len(queueNames) == 0 {
+		queueNames = []string{"default"}
+	}
+	q := &amqpWorkerQueue{
+		channel:    channel,
+		queueNames: queueNames,
+		declared:   map[string]bool{},
+		deliveries: map[*arachne.Request]amqp.Delivery{},
+	}
+	for _, name := range queueNames {
+		err := q.declare(name)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to initialize amqp worker queue: %w", err)
+		}
+	}
+	return q, nil
+}
+
+func (q *amqpWorkerQueue) declare(name string) error {
+	return q.declareQueue(name, amqp.Table{"x-max-priority": int32(amqpMaxPriority)})
+}
+
+// declareDelay declares the delay queue of the queue, whose expired messages are dead-lettered to the queue.
+func (q *amqpWorkerQueue) declareDelay(name string) error {
+	return q.declareQueue(name+amqpDelaySuffix, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": name,
+	})
+}
+
+func (q *amqpWorkerQueue) declareQueue(name string, args amqp.Table) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.declared[name] {
+		return nil
+	}
+	_, err := q.channel.QueueDeclare(
+		name,
+		true,
+		false,
+		false,
+		false,
+		args,
+	)
+	if err != nil {
+		return xerrors.Errorf("fail to declare queue %s: %w", name, err)
+	}
+	q.declared[name] = true
+	return nil
+}
+
+func (q *amqpWorkerQueue) nextConsumerTag() string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.consumerSeq++
+	return fmt.Sprintf("arachne-%p-%d", q, q.consumerSeq)
+}
+
+func (q *amqpWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *arachne.Request, error) {
+	requestChan := make(chan *arachne.Request)
+
+	consumerTags := make([]string, 0, len(q.queueNames))
+	deliveryChans := make([]<-chan amqp.Delivery, 0, len(q.queueNames))
+	for _, name := range q.queueNames {
+		tag := q.nextConsumerTag()
+		deliveries, err := q.channel.Consume(name, tag, false, false, false, false, nil)
+		if err != nil {
+			for _, t := range consumerTags {
+				_ = q.channel.Cancel(t, false)
+			}
+			return nil, xerrors.Errorf("fail to consume queue %s: %w", name, err)
+		}
+		consumerTags = append(consumerTags, tag)
+		deliveryChans = append(deliveryChans, deliveries)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, deliveries := range deliveryChans {
+		wg.Add(1)
+		go func(deliveries <-chan amqp.Delivery) {
+			defer wg.Done()
+			q.consume(ctx, deliveries, requestChan)
+		}(deliveries)
+	}
+
+	go func() {
+		<-ctx.Done()
+		// cancel consumers so that the broker stops delivering and closes the delivery channels
+		for _, tag := range consumerTags {
+			_ = q.channel.Cancel(tag, false)
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(requestChan)
+	}()
+
+	return requestChan, nil
+}
+
+func (q *amqpWorkerQueue) consume(
+	ctx context.Context,
+	deliveries <-chan amqp.Delivery,
+	requestChan chan<- *arachne.Request,
+) {
+	for delivery := range deliveries {
+		request, err := decodeRequest(delivery.Body)
+		if err != nil {
+			// a message that cannot be decoded will never be, so drop it.
+			log.Printf("drop message %d of queue %s: %v", delivery.DeliveryTag, delivery.RoutingKey, err)
+			_ = delivery.Nack(false, false)
+			continue
+		}
+		if request.NotBefore.After(time.Now()) {
+			// a request published before Request.NotBefore is set, or expired early by clock skew,
+			// goes through the delay queue again instead of being held unacked.
+			err := q.publish(request)
+			if err != nil {
+				_ = delivery.Nack(false, true)
+				continue
+			}
+			_ = delivery.Ack(false)
+			continue
+		}
+		q.deliver(ctx, request, delivery, requestChan)
+	}
+}
+
+func (q *amqpWorkerQueue) deliver(
+	ctx context.Context,
+	request *arachne.Request,
+	delivery amqp.Delivery,
+	requestChan chan<- *arachne.Request,
+) {
+	q.mutex.Lock()
+	q.deliveries[request] = delivery
+	q.mutex.Unlock()
+	select {
+	case requestChan <- request:
+	case <-ctx.Done():
+		q.mutex.Lock()
+		delete(q.deliveries, request)
+		q.mutex.Unlock()
+		_ = delivery.Nack(false, true)
+	}
+}
+
+// Ack acks the delivery of the request.
+func (q *amqpWorkerQueue) Ack(request *arachne.Request) error {
+	delivery, ok := q.takeDelivery(request)
+	if !ok {
+		return nil
+	}
+	err := delivery.Ack(false)
+	if err != nil {
+		return xerrors.Errorf("fail to ack %s: %w", request.URL, err)
+	}
+	return nil
+}
+
+// Nack requeues the delivery of the request.
+// A request that is not delivered by this queue is published instead.
+func (q *amqpWorkerQueue) Nack(request *arachne.Request) error {
+	delivery, ok := q.takeDelivery(request)
+	if !ok {
+		return q.publish(request)
+	}
+	err := delivery.Nack(false, true)
+	if err != nil {
+		return xerrors.Errorf("fail to nack %s: %w", request.URL, err)
+	}
+	return nil
+}
+
+func (q *amqpWorkerQueue) takeDelivery(request *arachne.Request) (amqp.Delivery, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delivery, ok := q.deliveries[request]
+	if ok {
+		delete(q.deliveries, request)
+	}
+	return delivery, ok
+}
+
+func (q *amqpWorkerQueue) RetryRequest(request *arachne.Request) error {
+	return q.publish(request)
+}
+
+func (q *amqpWorkerQueue) PublishRequest(request *arachne.Request) error {
+	return q.publish(request)
+}
+
+// publish fails without publishing the request if consumers cannot decode it.
+func (q *amqpWorkerQueue) publish(request *arachne.Request) error {
+	err := request.Validate()
+	if err != nil {
+		return xerrors.Errorf("fail to publish request: %w", err)
+	}
+	body, err := encodeRequest(request)
+	if err != nil {
+		return xerrors.Errorf("fail to publish request: %w", err)
+	}
+	queueName := request.QueueName
+	if queueName == "" {
+		queueName = "default"
+	}
+	err = q.declare(queueName)
+	if err != nil {
+		return xerrors.Errorf("fail to publish request %s: %w", request.URL, err)
+	}
+	publishing := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     amqpPriority(request.Priority),
+		Body:         body,
+	}
+	key := queueName
+	if wait := time.Until(request.NotBefore); wait > 0 {
+		err = q.declareDelay(queueName)
+		if err != nil {
+			return xerrors.Errorf("fail to publish request %s: %w", request.URL, err)
+		}
+		key = queueName + amqpDelaySuffix
+		publishing.Expiration = amqpExpiration(wait)
+	}
+	err = q.channel.Publish("", key, false, false, publishing)
+	if err != nil {
+		return xerrors.Errorf("fail to publish request %s: %w", request.URL, err)
+	}
+	return nil
+}
+
+// amqpExpiration formats wait as the expiration of a message, in milliseconds rounded up.
+func amqpExpiration(wait time.Duration) string {
+	return strconv.FormatInt(int64((wait+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+// amqpPriority maps Request.Priority, where a smaller value is consumed first,
+// to AMQP message priority, where a larger value is consumed first.
+func amqpPriority(priority int64) uint8 {
+	if priority <= 0 {
+		return amqpMaxPriority
+	}
+	if priority >= amqpMaxPriority {
+		return 0
+	}
+	return uint8(amqpMaxPriority - priority)
+}
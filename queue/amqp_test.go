@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+	"github.com/streadway/amqp"
+)
+
+// fakeAMQPChannel is an in-process stand-in for a RabbitMQ channel.
+// A message with an expiration published to a queue with a dead-letter routing key
+// is moved to the queue of the routing key when it expires.
+type fakeAMQPChannel struct {
+	mutex       sync.Mutex
+	queues      map[string]chan amqp.Delivery
+	args        map[string]amqp.Table
+	consumers   map[string]string
+	deliveryTag uint64
+	acked       []uint64
+	nacked      []uint64
+	expirations map[string][]string
+}
+
+func newFakeAMQPChannel() *fakeAMQPChannel {
+	return &fakeAMQPChannel{
+		queues:      map[string]chan amqp.Delivery{},
+		args:        map[string]amqp.Table{},
+		consumers:   map[string]string{},
+		expirations: map[string][]string{},
+	}
+}
+
+func (c *fakeAMQPChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.queues[name]; !ok {
+		c.queues[name] = make(chan amqp.Delivery, 1024)
+		c.args[name] = args
+	}
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeAMQPChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	queue, ok := c.queues[key]
+	if !ok {
+		return fmt.Errorf("queue %s is not declared", key)
+	}
+	if deadLetterKey, ok := c.args[key]["x-dead-letter-routing-key"].(string); ok && msg.Expiration != "" {
+		c.expirations[key] = append(c.expirations[key], msg.Expiration)
+		ttl, err := strconv.Atoi(msg.Expiration)
+		if err != nil {
+			return fmt.Errorf("invalid expiration %s", msg.Expiration)
+		}
+		msg.Expiration = ""
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			_ = c.Publish("", deadLetterKey, false, false, msg)
+		})
+		return nil
+	}
+	c.deliveryTag++
+	queue <- amqp.Delivery{
+		Acknowledger: c,
+		DeliveryTag:  c.deliveryTag,
+		ContentType:  msg.ContentType,
+		Priority:     msg.Priority,
+		Body:         msg.Body,
+		RoutingKey:   key,
+	}
+	return nil
+}
+
+func (c *fakeAMQPChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch, ok := c.queues[queue]
+	if !ok {
+		return nil, fmt.Errorf("queue %s is not declared", queue)
+	}
+	c.consumers[consumer] = queue
+	return ch, nil
+}
+
+func (c *fakeAMQPChannel) Cancel(consumer string, noWait bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	queue, ok := c.consumers[consumer]
+	if !ok {
+		return fmt.Errorf("consumer %s does not exist", consumer)
+	}
+	delete(c.consumers, consumer)
+	close(c.queues[queue])
+	return nil
+}
+
+func (c *fakeAMQPChannel) Ack(tag uint64, multiple bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.acked = append(c.acked, tag)
+	return nil
+}
+
+func (c *fakeAMQPChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.nacked = append(c.nacked, tag)
+	return nil
+}
+
+func (c *fakeAMQPChannel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+func TestAMQPWorkerQueue_PublishRequest(t *testing.T) {
+	channel := newFakeAMQPChannel()
+	q, err := NewAMQPWorkerQueue(channel)
+	if err != nil {
+		t.Fatalf("fail to create queue: %v", err)
+	}
+
+	tests := []struct {
+		priority int64
+		expected uint8
+	}{
+		{-1, 9},
+		{0, 9},
+		{3, 6},
+		{9, 0},
+		{100, 0},
+	}
+	for i, tt := range tests {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		r.Priority = tt.priority
+		r.QueueName = "detail"
+		err := q.PublishRequest(r)
+		if err != nil {
+			t.Fatalf("test case %d: fail to publish: %v", i, err)
+		}
+		delivery := <-channel.queues["detail"]
+		if delivery.Priority != tt.expected {
+			t.Fatalf("test case %d: expected priority %d, but got %d", i, tt.expected, delivery.Priority)
+		}
+	}
+
+	// a request that consumers cannot decode is rejected instead of dropped on consumption
+	relative := &arachne.Request{URL: "/relative", QueueName: "detail"}
+	if err := q.PublishRequest(relative); err == nil {
+		t.Fatalf("expected error for publishing %s, but got nil", relative.URL)
+	}
+	if len(channel.queues["detail"]) != 0 {
+		t.Fatalf("expected no message, but got %d", len(channel.queues["detail"]))
+	}
+}
+
+func TestAMQPWorkerQueue_SubscribeRequests(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	channel := newFakeAMQPChannel()
+	q, err := NewAMQPWorkerQueue(channel, "seeds", "detail")
+	if err != nil {
+		t.Fatalf("fail to create queue: %v", err)
+	}
+
+	num := 100
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		r.Method = "POST"
+		r.Body = []byte("body")
+		r.Header.Set("X-Test", "test")
+		if i%2 == 0 {
+			r.QueueName = "seeds"
+		} else {
+			r.QueueName = "detail"
+		}
+		err := q.PublishRequest(r)
+		if err != nil {
+			t.Fatalf("fail to publish: %v", err)
+		}
+	}
+	// an undecodable message must not stop the consumer
+	_ = channel.Publish("", "seeds", false, false, amqp.Publishing{Body: []byte("{")})
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	ackingQueue := q.(arachne.AckingWorkerQueue)
+	for i := 0; i < num; i++ {
+		request := <-ch
+		if request.URLHost() != "golang.org" {
+			t.Fatalf("url domain mismatch")
+		}
+		if request.Method != "POST" || string(request.Body) != "body" || request.Header.Get("X-Test") != "test" {
+			t.Fatalf("request is not restored: %v", request)
+		}
+		err := ackingQueue.Ack(request)
+		if err != nil {
+			t.Fatalf("fail to ack: %v", err)
+		}
+	}
+	cancelFunc()
+	for range ch {
+	}
+
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	if len(channel.acked) != num {
+		t.Fatalf("expected %d acks, but got %d", num, len(channel.acked))
+	}
+	if len(channel.nacked) != 1 {
+		t.Fatalf("expected %d nack, but got %d", 1, len(channel.nacked))
+	}
+}
+
+func TestAMQPWorkerQueue_SubscribeRequestsNotBefore(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	channel := newFakeAMQPChannel()
+	q, err := NewAMQPWorkerQueue(channel)
+	if err != nil {
+		t.Fatalf("fail to create queue: %v", err)
+	}
+
+	notBefore := time.Now().Add(50 * time.Millisecond)
+	delayed, _ := arachne.NewGetRequest("https://golang.org/delayed")
+	delayed.NotBefore = notBefore
+	q.PublishRequest(delayed)
+	ready, _ := arachne.NewGetRequest("https://golang.org/ready")
+	q.PublishRequest(ready)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	request := <-ch
+	if request.URL != ready.URL {
+		t.Fatalf("expected %s, but got %s", ready.URL, request.URL)
+	}
+	request = <-ch
+	if request.URL != delayed.URL || time.Now().Before(notBefore) {
+		t.Fatalf("%s is delivered before %v", request.URL, notBefore)
+	}
+
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	if expirations := channel.expirations["default.delay"]; len(expirations) != 1 {
+		t.Fatalf("expected the delayed request to go through the delay queue, but got %v", expirations)
+	}
+}
+
+func TestAMQPWorkerQueue_SubscribeRequestsRedelay(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	channel := newFakeAMQPChannel()
+	q, err := NewAMQPWorkerQueue(channel)
+	if err != nil {
+		t.Fatalf("fail to create queue: %v", err)
+	}
+
+	// a delayed request published directly to the queue
+	notBefore := time.Now().Add(50 * time.Millisecond)
+	delayed, _ := arachne.NewGetRequest("https://golang.org/delayed")
+	delayed.NotBefore = notBefore
+	body, _ := encodeRequest(delayed)
+	_ = channel.Publish("", "default", false, false, amqp.Publishing{Body: body})
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	request := <-ch
+	if request.URL != delayed.URL || time.Now().Before(notBefore) {
+		t.Fatalf("%s is delivered before %v", request.URL, notBefore)
+	}
+
+	// the original delivery is acked when it is delayed again, not held unacked
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	if len(channel.acked) != 1 || channel.acked[0] != 1 {
+		t.Fatalf("expected the original delivery to be acked, but got %v", channel.acked)
+	}
+	if len(channel.expirations["default.delay"]) != 1 {
+		t.Fatalf("expected the request to go through the delay queue, but got %v", channel.expirations)
+	}
+}
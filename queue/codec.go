@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"encoding/json"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// encodeRequest encodes the request for external queues in the format of arachne.Request.MarshalJSON.
+func encodeRequest(request *arachne.Request) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to encode request %s: %w", request.URL, err)
+	}
+	return data, nil
+}
+
+func decodeRequest(data []byte) (*arachne.Request, error) {
+	request := new(arachne.Request)
+	err := json.Unmarshal(data, request)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to decode request: %w", err)
+	}
+	return request, nil
+}
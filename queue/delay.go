@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+// delayedRequests is a min-heap of requests ordered by Request.NotBefore.
+type delayedRequests []*arachne.Request
+
+func (d delayedRequests) Len() int           { return len(d) }
+func (d delayedRequests) Less(i, j int) bool { return d[i].NotBefore.Before(d[j].NotBefore) }
+func (d delayedRequests) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (d *delayedRequests) Push(x interface{}) {
+	*d = append(*d, x.(*arachne.Request))
+}
+
+func (d *delayedRequests) Pop() interface{} {
+	old := *d
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*d = old[:n-1]
+	return x
+}
+
+// delay withholds the request until Request.NotBefore. cond.L must be held.
+func (q *memoryWorkerQueue) delay(request *arachne.Request) {
+	if q.delayedKeys == nil {
+		q.delayedKeys = map[string]bool{}
+	}
+	heap.Push(&q.delayed, request)
+	q.delayedKeys[arachne.Fingerprint(request)] = true
+}
+
+// promote moves the delayed requests whose time has come to the queue. cond.L must be held.
+func (q *memoryWorkerQueue) promote(now time.Time) {
+	for len(q.delayed) > 0 && !q.delayed[0].NotBefore.After(now) {
+		request := heap.Pop(&q.delayed).(*arachne.Request)
+		delete(q.delayedKeys, arachne.Fingerprint(request))
+		q.enqueue(request)
+	}
+}
+
+// scheduleWakeUp wakes the subscribers up when the earliest delayed request or waiting host is ready.
+// cond.L must be held.
+func (q *memoryWorkerQueue) scheduleWakeUp() {
+	wakeUpAt, ok := q.nextHostReadyAt(time.Now())
+	if len(q.delayed) > 0 && (!ok || q.delayed[0].NotBefore.Before(wakeUpAt)) {
+		wakeUpAt = q.delayed[0].NotBefore
+		ok = true
+	}
+	if !ok {
+		return
+	}
+	if q.wakeUpTimer != nil {
+		q.wakeUpTimer.Stop()
+	}
+	q.wakeUpTimer = time.AfterFunc(time.Until(wakeUpAt), func() {
+		q.cond.L.Lock()
+		defer q.cond.L.Unlock()
+		q.cond.Broadcast()
+	})
+}
@@ -0,0 +1,351 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+
+	"github.com/getumen/arachne"
+	"golang.org/x/xerrors"
+)
+
+// minCompactionRecords is the number of journal records below which the journal is never compacted.
+const minCompactionRecords = 1024
+
+const (
+	opPublish    = "publish"
+	opConsume    = "consume"
+	opDeadLetter = "dead_letter"
+	opReinject   = "reinject"
+)
+
+// journalRecord is a line of the journal file.
+type journalRecord struct {
+	Op          string          `json:"op"`
+	URL         string          `json:"url,omitempty"`
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// FileWorkerQueue is a WorkerQueue that keeps the frontier in memory with the same ordering
+// and de-duplication as the memory WorkerQueue, and journals every publication and consumption
+// to an append-only file. Reopening the file restores the requests that were published but never consumed.
+// The journal is compacted when most of its records are obsolete.
+type FileWorkerQueue struct {
+	memory  *memoryWorkerQueue
+	path    string
+	file    *os.File
+	records int
+	err     error
+}
+
+// NewFileWorkerQueue opens or creates the journal at path and restores its pending requests.
+// With WithVisibilityTimeout, a request is journaled as consumed when it is acked
+// so that requests in flight at a crash are restored as well.
+func NewFileWorkerQueue(path string, options ...Option) (*FileWorkerQueue, error) {
+	q := &FileWorkerQueue{
+		memory: newMemoryWorkerQueue(options...),
+		path:   path,
+	}
+	err := q.restore()
+	if err != nil {
+		return nil, xerrors.Errorf("fail to restore journal %s: %w", path, err)
+	}
+	q.memory.journal = q
+	return q, nil
+}
+
+func (q *FileWorkerQueue) restore() error {
+	file, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return xerrors.Errorf("fail to open journal: %w", err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a partial line is the trace of a crash while writing it.
+			break
+		} else if err != nil {
+			file.Close()
+			return xerrors.Errorf("fail to read journal: %w", err)
+		}
+		record := journalRecord{}
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			file.Close()
+			return xerrors.Errorf("journal is broken at offset %d: %w", offset, err)
+		}
+		err = q.replay(&record)
+		if err != nil {
+			file.Close()
+			return xerrors.Errorf("journal is broken at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+		q.records++
+	}
+	err = file.Truncate(offset)
+	if err != nil {
+		file.Close()
+		return xerrors.Errorf("fail to truncate journal: %w", err)
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return xerrors.Errorf("fail to seek journal: %w", err)
+	}
+	q.file = file
+	return nil
+}
+
+func (q *FileWorkerQueue) replay(record *journalRecord) error {
+	switch record.Op {
+	case opPublish:
+		request, err := decodeRequest(record.Request)
+		if err != nil {
+			// the request could never be fetched, so the rest of the journal is still restored.
+			log.Printf("skip the publication in journal %s: %v", q.path, err)
+			return nil
+		}
+		return q.memory.push(request)
+	case opConsume:
+		q.memory.dequeue(record.Fingerprint)
+		return nil
+	case opDeadLetter:
+		request, err := decodeRequest(record.Request)
+		if err != nil {
+			return xerrors.Errorf("fail to replay dead letter: %w", err)
+		}
+		q.memory.bury(&arachne.DeadLetter{
+			Request:    request,
+			StatusCode: record.StatusCode,
+			Error:      record.Error,
+		})
+		return nil
+	case opReinject:
+		delete(q.memory.deadLetters, record.Fingerprint)
+		return nil
+	default:
+		return xerrors.Errorf("unknown operation %s", record.Op)
+	}
+}
+
+// SubscribeRequests subscribes pending requests.
+func (q *FileWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *arachne.Request, error) {
+	return q.memory.SubscribeRequests(ctx)
+}
+
+// RetryRequest adds request to the queue.
+// It fails if the request cannot be restored from the journal.
+func (q *FileWorkerQueue) RetryRequest(request *arachne.Request) error {
+	err := request.Validate()
+	if err != nil {
+		return xerrors.Errorf("fail to retry request: %w", err)
+	}
+	return q.memory.RetryRequest(request)
+}
+
+// PublishRequest adds request to the queue.
+// It fails if the request cannot be restored from the journal.
+func (q *FileWorkerQueue) PublishRequest(request *arachne.Request) error {
+	err := request.Validate()
+	if err != nil {
+		return xerrors.Errorf("fail to publish request: %w", err)
+	}
+	return q.memory.PublishRequest(request)
+}
+
+// Ack tells the queue that the request has been processed.
+func (q *FileWorkerQueue) Ack(request *arachne.Request) error {
+	return q.memory.Ack(request)
+}
+
+// Nack puts the request back to the queue.
+func (q *FileWorkerQueue) Nack(request *arachne.Request) error {
+	return q.memory.Nack(request)
+}
+
+// PendingRequests returns the queued, in-flight and delayed requests.
+func (q *FileWorkerQueue) PendingRequests() ([]*arachne.Request, error) {
+	return q.memory.PendingRequests()
+}
+
+// PublishDeadLetter stores the dead letter.
+func (q *FileWorkerQueue) PublishDeadLetter(letter *arachne.DeadLetter) error {
+	return q.memory.PublishDeadLetter(letter)
+}
+
+// DeadLetters returns the stored dead letters in the order of url.
+func (q *FileWorkerQueue) DeadLetters() ([]*arachne.DeadLetter, error) {
+	return q.memory.DeadLetters()
+}
+
+// DeadLetter returns the dead letter of the request with the fingerprint, or nil if it does not exist.
+func (q *FileWorkerQueue) DeadLetter(fingerprint string) (*arachne.DeadLetter, error) {
+	return q.memory.DeadLetter(fingerprint)
+}
+
+// ReinjectDeadLetter removes the dead letter of the request with the fingerprint and publishes its request again.
+func (q *FileWorkerQueue) ReinjectDeadLetter(fingerprint string) error {
+	return q.memory.ReinjectDeadLetter(fingerprint)
+}
+
+// Close flushes the journal to the disk and closes it.
+// It returns the first error that occurred while journaling a consumption, if any.
+func (q *FileWorkerQueue) Close() error {
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.file == nil {
+		return q.err
+	}
+	err := q.file.Sync()
+	if err != nil {
+		q.file.Close()
+		q.file = nil
+		return xerrors.Errorf("fail to sync journal: %w", err)
+	}
+	err = q.file.Close()
+	q.file = nil
+	if err != nil {
+		return xerrors.Errorf("fail to close journal: %w", err)
+	}
+	return q.err
+}
+
+func (q *FileWorkerQueue) published(request *arachne.Request) error {
+	data, err := encodeRequest(request)
+	if err != nil {
+		return xerrors.Errorf("fail to journal publication: %w", err)
+	}
+	return q.append(&journalRecord{Op: opPublish, Request: data})
+}
+
+func (q *FileWorkerQueue) consumed(request *arachne.Request) {
+	err := q.append(&journalRecord{Op: opConsume, URL: request.URL, Fingerprint: arachne.Fingerprint(request)})
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *FileWorkerQueue) deadLettered(letter *arachne.DeadLetter) error {
+	record, err := deadLetterRecord(letter)
+	if err != nil {
+		return xerrors.Errorf("fail to journal dead letter: %w", err)
+	}
+	return q.append(record)
+}
+
+func (q *FileWorkerQueue) reinjected(letter *arachne.DeadLetter) error {
+	return q.append(&journalRecord{
+		Op:          opReinject,
+		URL:         letter.Request.URL,
+		Fingerprint: arachne.Fingerprint(letter.Request),
+	})
+}
+
+func deadLetterRecord(letter *arachne.DeadLetter) (*journalRecord, error) {
+	data, err := encodeRequest(letter.Request)
+	if err != nil {
+		return nil, err
+	}
+	return &journalRecord{
+		Op:         opDeadLetter,
+		Request:    data,
+		StatusCode: letter.StatusCode,
+		Error:      letter.Error,
+	}, nil
+}
+
+func (q *FileWorkerQueue) append(record *journalRecord) error {
+	if q.file == nil {
+		return xerrors.New("journal is closed")
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return xerrors.Errorf("fail to encode journal record: %w", err)
+	}
+	// compact before writing because a published request is not pending yet.
+	live := q.memory.queuedCount() + len(q.memory.inflight) + len(q.memory.delayed) + len(q.memory.deadLetters)
+	if q.records >= minCompactionRecords && q.records > 2*live {
+		err = q.compact()
+		if err != nil {
+			return xerrors.Errorf("fail to compact journal: %w", err)
+		}
+	}
+	_, err = q.file.Write(append(line, '\n'))
+	if err != nil {
+		return xerrors.Errorf("fail to write journal: %w", err)
+	}
+	q.records++
+	return nil
+}
+
+// compact rewrites the journal so that it holds only publications of pending requests and dead letters.
+func (q *FileWorkerQueue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return xerrors.Errorf("fail to create %s: %w", tmpPath, err)
+	}
+	writer := bufio.NewWriter(tmp)
+	pending := q.memory.pending()
+	records := make([]*journalRecord, 0, len(pending)+len(q.memory.deadLetters))
+	for _, request := range pending {
+		data, err := encodeRequest(request)
+		if err != nil {
+			tmp.Close()
+			return xerrors.Errorf("fail to compact journal: %w", err)
+		}
+		records = append(records, &journalRecord{Op: opPublish, Request: data})
+	}
+	for _, letter := range q.memory.deadLetters {
+		record, err := deadLetterRecord(letter)
+		if err != nil {
+			tmp.Close()
+			return xerrors.Errorf("fail to compact journal: %w", err)
+		}
+		records = append(records, record)
+	}
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			tmp.Close()
+			return xerrors.Errorf("fail to encode journal record: %w", err)
+		}
+		_, err = writer.Write(append(line, '\n'))
+		if err != nil {
+			tmp.Close()
+			return xerrors.Errorf("fail to write %s: %w", tmpPath, err)
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return xerrors.Errorf("fail to flush %s: %w", tmpPath, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return xerrors.Errorf("fail to close %s: %w", tmpPath, err)
+	}
+	err = os.Rename(tmpPath, q.path)
+	if err != nil {
+		return xerrors.Errorf("fail to replace journal: %w", err)
+	}
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return xerrors.Errorf("fail to reopen journal: %w", err)
+	}
+	q.file.Close()
+	q.file = file
+	q.records = len(records)
+	return nil
+}
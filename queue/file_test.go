@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func setupTestFileWorkerQueue(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "arachne")
+	if err != nil {
+		t.Fatalf("fail to create temp dir: %v", err)
+	}
+	return filepath.Join(dir, "journal"), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileWorkerQueue_Restore(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	num := 100
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		r.Priority = int64(num - i)
+		q.PublishRequest(r)
+		// duplicated publication is ignored
+		q.PublishRequest(r)
+	}
+
+	consumed := 10
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	for i := 0; i < consumed; i++ {
+		<-ch
+	}
+	cancelFunc()
+	for range ch {
+		consumed++
+	}
+	err = q.Close()
+	if err != nil {
+		t.Fatalf("fail to close: %v", err)
+	}
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	pending := q.memory.pending()
+	if len(pending) != num-consumed {
+		t.Fatalf("expected %d, but got %d", num-consumed, len(pending))
+	}
+	for i, request := range pending {
+		// requests with smaller priority are consumed first
+		if request.Priority != int64(consumed+i+1) {
+			t.Fatalf("expected priority %d, but got %d", consumed+i+1, request.Priority)
+		}
+		if request.URLHost() != "golang.org" {
+			t.Fatalf("url domain mismatch")
+		}
+	}
+}
+
+func TestFileWorkerQueue_Compact(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	for i := 0; i < 10*minCompactionRecords; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
+		q.PublishRequest(r)
+		<-ch
+	}
+	r, _ := arachne.NewGetRequest("https://golang.org/pending")
+	q.PublishRequest(r)
+	cancelFunc()
+	for range ch {
+	}
+	q.memory.cond.L.Lock()
+	records := q.records
+	expected := q.memory.queue.GetCount()
+	q.memory.cond.L.Unlock()
+	if records > 2*minCompactionRecords {
+		t.Fatalf("journal is not compacted: %d records", records)
+	}
+	q.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.memory.queue.GetCount() != expected {
+		t.Fatalf("expected %d, but got %d", expected, q.memory.queue.GetCount())
+	}
+}
+
+func TestFileWorkerQueue_RestorePartialRecord(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+	q.PublishRequest(r)
+	q.Close()
+
+	// simulate a crash while writing a record
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"op":"publ`)
+	file.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	r, _ = arachne.NewGetRequest("https://golang.org/doc/")
+	q.PublishRequest(r)
+	q.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.memory.queue.GetCount() != 2 {
+		t.Fatalf("expected %d, but got %d", 2, q.memory.queue.GetCount())
+	}
+}
+
+func TestFileWorkerQueue_InvalidRequest(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	relative := &arachne.Request{URL: "/relative", QueueName: "default"}
+	if err := q.PublishRequest(relative); err == nil {
+		t.Fatalf("expected error for publishing %s, but got nil", relative.URL)
+	}
+	if err := q.RetryRequest(relative); err == nil {
+		t.Fatalf("expected error for retrying %s, but got nil", relative.URL)
+	}
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+	q.PublishRequest(r)
+	q.Close()
+
+	// a journal written before the validation may contain an undecodable publication
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"op":"publish","request":{"url":"/relative"}}` + "\n")
+	file.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.memory.queue.GetCount() != 1 {
+		t.Fatalf("expected %d, but got %d", 1, q.memory.queue.GetCount())
+	}
+}
+
+func TestFileWorkerQueue_RestoreUnacked(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path, WithVisibilityTimeout(time.Hour))
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	for _, u := range []string{"https://golang.org/", "https://golang.org/doc/"} {
+		r, _ := arachne.NewGetRequest(u)
+		q.PublishRequest(r)
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	q.Ack(<-ch)
+	<-ch
+	cancelFunc()
+	for range ch {
+	}
+	q.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.memory.queue.GetCount() != 1 {
+		t.Fatalf("expected %d, but got %d", 1, q.memory.queue.GetCount())
+	}
+}
+
+func TestFileWorkerQueue_RestoreDeadLetters(t *testing.T) {
+	path, tearDown := setupTestFileWorkerQueue(t)
+	defer tearDown()
+
+	q, err := NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to open queue: %v", err)
+	}
+	for _, u := range []string{"https://golang.org/", "https://golang.org/doc/"} {
+		r, _ := arachne.NewGetRequest(u)
+		q.PublishDeadLetter(&arachne.DeadLetter{Request: r, StatusCode: 503, Error: "unavailable"})
+	}
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+	q.ReinjectDeadLetter(arachne.Fingerprint(r))
+	q.Close()
+
+	q, err = NewFileWorkerQueue(path)
+	if err != nil {
+		t.Fatalf("fail to reopen queue: %v", err)
+	}
+	defer q.Close()
+	letters, _ := q.DeadLetters()
+	if len(letters) != 1 || letters[0].Request.URL != "https://golang.org/doc/" || letters[0].StatusCode != 503 {
+		t.Fatalf("unexpected dead letters: %v", letters)
+	}
+	q.memory.cond.L.Lock()
+	defer q.memory.cond.L.Unlock()
+	if q.memory.queued(arachne.Fingerprint(r)) == nil {
+		t.Fatalf("reinjected request is not restored")
+	}
+}
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+// WithHostSharding makes each named queue keep one shard per Request.URLHost
+// and SubscribeRequests round-robin across the hosts that are ready, like the back queues of Mercator.
+// A host is ready when less than maxInFlight requests of the host are in flight and
+// delay has passed since the last delivery of the host. Zero disables each restriction.
+// Requests are in flight until they are acked, so maxInFlight needs WithVisibilityTimeout to take effect.
+func WithHostSharding(maxInFlight int, delay time.Duration) Option {
+	return func(q *memoryWorkerQueue) {
+		q.hostSharding = true
+		q.maxInFlightPerHost = maxInFlight
+		q.hostDelay = delay
+	}
+}
+
+// hostState is the politeness state of a host.
+type hostState struct {
+	inFlight int
+	readyAt  time.Time
+}
+
+// hostWait is a host, or the key of its shard, that is ready at readyAt.
+type hostWait struct {
+	key     string
+	readyAt time.Time
+}
+
+// hostWaits is a min-heap of hostWait ordered by readyAt.
+type hostWaits []hostWait
+
+func (h hostWaits) Len() int           { return len(h) }
+func (h hostWaits) Less(i, j int) bool { return h[i].readyAt.Before(h[j].readyAt) }
+func (h hostWaits) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *hostWaits) Push(x interface{}) {
+	*h = append(*h, x.(hostWait))
+}
+
+func (h *hostWaits) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// shardKey returns the key of the shard of the request in its named queue. cond.L must be held.
+func (q *memoryWorkerQueue) shardKey(request *arachne.Request) string {
+	if !q.hostSharding {
+		return ""
+	}
+	return request.URLHost()
+}
+
+// hostReady reports whether a request of the host can be delivered. cond.L must be held.
+func (q *memoryWorkerQueue) hostReady(host string, now time.Time) bool {
+	state, ok := q.hosts[host]
+	if !q.hostSharding || !ok {
+		return true
+	}
+	if q.maxInFlightPerHost > 0 && state.inFlight >= q.maxInFlightPerHost {
+		return false
+	}
+	return !now.Before(state.readyAt)
+}
+
+// hostDelivered records the delivery of the request. cond.L must be held.
+func (q *memoryWorkerQueue) hostDelivered(request *arachne.Request, now time.Time) {
+	if !q.hostSharding {
+		return
+	}
+	if q.hosts == nil {
+		q.hosts = map[string]*hostState{}
+	}
+	host := q.shardKey(request)
+	state, ok := q.hosts[host]
+	if !ok {
+		state = &hostState{}
+		q.hosts[host] = state
+	}
+	state.inFlight++
+	state.readyAt = now.Add(q.hostDelay)
+	if q.hostDelay > 0 {
+		heap.Push(&q.hostExpiries, hostWait{key: host, readyAt: state.readyAt})
+	}
+}
+
+// hostDone records that the request is no longer in flight. cond.L must be held.
+func (q *memoryWorkerQueue) hostDone(request *arachne.Request) {
+	if !q.hostSharding {
+		return
+	}
+	host := q.shardKey(request)
+	state, ok := q.hosts[host]
+	if !ok {
+		return
+	}
+	if state.inFlight > 0 {
+		state.inFlight--
+	}
+	now := time.Now()
+	if state.inFlight == 0 && !state.readyAt.After(now) {
+		delete(q.hosts, host)
+	}
+	// a host may become ready
+	q.unblock(host, now)
+	q.cond.Broadcast()
+}
+
+// nextHostReadyAt returns the earliest time when a host of queued requests becomes ready after its delay,
+// and forgets the hosts that no longer restrict delivery. cond.L must be held.
+func (q *memoryWorkerQueue) nextHostReadyAt(now time.Time) (time.Time, bool) {
+	for len(q.hostExpiries) > 0 && !q.hostExpiries[0].readyAt.After(now) {
+		host := heap.Pop(&q.hostExpiries).(hostWait).key
+		// a host in flight is forgotten by hostDone instead.
+		if state, ok := q.hosts[host]; ok && state.inFlight == 0 && !state.readyAt.After(now) {
+			delete(q.hosts, host)
+		}
+	}
+	var next time.Time
+	found := false
+	for _, named := range q.queues {
+		if len(named.waiting) == 0 {
+			continue
+		}
+		if readyAt := named.waiting[0].readyAt; !found || readyAt.Before(next) {
+			next = readyAt
+			found = true
+		}
+	}
+	return next, found
+}
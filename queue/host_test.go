@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getumen/arachne"
+)
+
+func publishTestHostRequests(q *memoryWorkerQueue, host string, num int) {
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://%s/%d", host, i))
+		r.Priority = int64(i)
+		q.PublishRequest(r)
+	}
+}
+
+func TestMemoryWorkerQueue_HostRoundRobin(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithHostSharding(0, 0))
+	publishTestHostRequests(q, "a.example.com", 100)
+	publishTestHostRequests(q, "b.example.com", 3)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	counter := map[string]int{}
+	for i := 0; i < 6; i++ {
+		request := <-ch
+		counter[request.URLHost()]++
+	}
+	if counter["b.example.com"] != 3 {
+		t.Fatalf("expected 3 requests from b.example.com, but got %d", counter["b.example.com"])
+	}
+}
+
+func TestMemoryWorkerQueue_HostMaxInFlight(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithVisibilityTimeout(time.Minute), WithHostSharding(1, 0))
+	publishTestHostRequests(q, "a.example.com", 3)
+	publishTestHostRequests(q, "b.example.com", 3)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	first := <-ch
+	second := <-ch
+	if first.URLHost() == second.URLHost() {
+		t.Fatalf("expected requests from different hosts, but got %s twice", first.URLHost())
+	}
+
+	select {
+	case request := <-ch:
+		t.Fatalf("expected no request while both hosts are in flight, but got %s", request.URL)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = q.Ack(first)
+	if err != nil {
+		t.Fatalf("fail to ack: %v", err)
+	}
+	select {
+	case request := <-ch:
+		if request.URLHost() != first.URLHost() {
+			t.Fatalf("expected a request from %s, but got %s", first.URLHost(), request.URL)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a request after ack")
+	}
+}
+
+func TestMemoryWorkerQueue_HostDelay(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	delay := 100 * time.Millisecond
+	q := newMemoryWorkerQueue(WithHostSharding(0, delay))
+	publishTestHostRequests(q, "a.example.com", 2)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	start := time.Now()
+	<-ch
+	<-ch
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("expected the second request after %v, but got it after %v", delay, elapsed)
+	}
+}
+
+func TestMemoryWorkerQueue_HostFrontier(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	delay := 50 * time.Millisecond
+	q := newMemoryWorkerQueue(WithHostSharding(0, delay))
+	hosts := 100
+	for i := 0; i < hosts; i++ {
+		publishTestHostRequests(q, fmt.Sprintf("%d.example.com", i), 2)
+	}
+	// a shard that is emptied and filled again is delivered from
+	removed, _ := arachne.NewGetRequest("https://removed.example.com/")
+	q.PublishRequest(removed)
+	q.cond.L.Lock()
+	q.dequeue(arachne.Fingerprint(removed))
+	q.cond.L.Unlock()
+	refilled, _ := arachne.NewGetRequest("https://removed.example.com/refilled")
+	q.PublishRequest(refilled)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	delivered := map[string]time.Time{}
+	for i := 0; i < 2*hosts+1; i++ {
+		request := <-ch
+		host := request.URLHost()
+		// the time of receipt lags behind the time of delivery by a varying amount
+		if last, ok := delivered[host]; ok && time.Since(last) < delay/2 {
+			t.Fatalf("expected %s after %v, but got it after %v", host, delay, time.Since(last))
+		}
+		delivered[host] = time.Now()
+	}
+	if _, ok := delivered["removed.example.com"]; !ok {
+		t.Fatalf("expected the refilled request to be delivered")
+	}
+
+	time.Sleep(2 * delay)
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.nextHostReadyAt(time.Now())
+	if len(q.hosts) != 0 {
+		t.Fatalf("expected the hosts to be forgotten, but got %d", len(q.hosts))
+	}
+}
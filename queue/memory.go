@@ -2,27 +2,103 @@ package queue
 
 import (
 	"context"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/getumen/arachne"
 	"github.com/wangjia184/sortedset"
+	"golang.org/x/xerrors"
 )
 
-var cond *sync.Cond
+// journal records queue operations so that a queue can be restored.
+// cond.L of the queue is held when its methods are called.
+type journal interface {
+	published(request *arachne.Request) error
+	consumed(request *arachne.Request)
+	deadLettered(letter *arachne.DeadLetter) error
+	reinjected(letter *arachne.DeadLetter) error
+}
+
+// Option configures the memory WorkerQueue and the queues built on it.
+type Option func(q *memoryWorkerQueue)
+
+// WithVisibilityTimeout makes the queue deliver a subscribed request again
+// unless it is acked within timeout.
+// Requests that are delivered but not acked yet are regarded as pending
+// so that the same url is not published twice meanwhile.
+func WithVisibilityTimeout(timeout time.Duration) Option {
+	return func(q *memoryWorkerQueue) {
+		q.visibilityTimeout = timeout
+	}
+}
+
+// WithDupeFilter makes PublishRequest drop requests that the filter has seen.
+// Without this option, only a request with the same fingerprint as a pending request is dropped.
+// A request is recorded in the filter only after it is queued, so a request that fails to be queued is not lost.
+// Retried, nacked and re-injected requests are not checked by the filter.
+func WithDupeFilter(filter arachne.DupeFilter) Option {
+	return func(q *memoryWorkerQueue) {
+		q.dupeFilter = filter
+	}
+}
 
-func init() {
-	cond = sync.NewCond(&sync.Mutex{})
+// inflightRequest is a request that is delivered but not acked.
+type inflightRequest struct {
+	request     *arachne.Request
+	fingerprint string
+	timer       *time.Timer
 }
 
 type memoryWorkerQueue struct {
-	queue *sortedset.SortedSet
+	// cond guards the fields below and is broadcast when a request may become deliverable.
+	cond               *sync.Cond
+	queue              *sortedset.SortedSet
+	journal            journal
+	dupeFilter         arachne.DupeFilter
+	visibilityTimeout  time.Duration
+	inflight           map[string]*inflightRequest
+	deadLetters        map[string]*arachne.DeadLetter
+	delayed            delayedRequests
+	delayedKeys        map[string]bool
+	wakeUpTimer        *time.Timer
+	queues             map[string]*namedQueue
+	index              map[string]*arachne.Request
+	weights            map[string]int
+	strictOrder        []string
+	credits            map[string]int
+	hostSharding       bool
+	maxInFlightPerHost int
+	hostDelay          time.Duration
+	hosts              map[string]*hostState
+	// hostExpiries is the hosts in the order of the time when their delay has passed.
+	hostExpiries hostWaits
+	// names is the names of queues in the order of name.
+	names []string
+	// queuedNum is the number of requests in the shards of queues.
+	queuedNum int
+	// expired is the set of deliveries whose visibility timeout has expired and that are not acked or nacked yet.
+	expired map[*arachne.Request]bool
+}
+
+// NewMemoryWorkerQueue return Memory WorkerQueue implementation.
+// The returned queue implements arachne.AckingWorkerQueue, arachne.DeadLetterQueue and arachne.InspectableWorkerQueue.
+func NewMemoryWorkerQueue(options ...Option) (arachne.WorkerQueue, error) {
+	return newMemoryWorkerQueue(options...), nil
 }
 
-// NewMemoryWorkerQueue return Memory WorkerQueue implementation
-func NewMemoryWorkerQueue() (arachne.WorkerQueue, error) {
-	return &memoryWorkerQueue{
-		queue: sortedset.New(),
-	}, nil
+func newMemoryWorkerQueue(options ...Option) *memoryWorkerQueue {
+	q := &memoryWorkerQueue{
+		cond:        sync.NewCond(&sync.Mutex{}),
+		queue:       sortedset.New(),
+		inflight:    map[string]*inflightRequest{},
+		deadLetters: map[string]*arachne.DeadLetter{},
+	}
+	for _, option := range options {
+		option(q)
+	}
+	return q
 }
 
 func (q *memoryWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *arachne.Request, error) {
@@ -31,26 +107,25 @@ func (q *memoryWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *arac
 	go func() {
 		defer close(requestChan)
 		for {
-			var ok bool
-			select {
-			case _, ok = <-ctx.Done():
-			default:
-				ok = true
-			}
-			if !ok {
-				break
+			request := q.next(ctx)
+			if request == nil {
+				return
 			}
-			cond.L.Lock()
-			node := q.queue.PopMin()
-			if node != nil {
-				request, ok := node.Value.(*arachne.Request)
-				if ok {
-					requestChan <- request
+			// send without holding the lock so that the subscriber can ack meanwhile
+			select {
+			case requestChan <- request:
+				q.cond.L.Lock()
+				q.delivered(request)
+				q.cond.L.Unlock()
+			case <-ctx.Done():
+				q.cond.L.Lock()
+				if entry := q.inflight[arachne.Fingerprint(request)]; entry != nil && entry.request == request {
+					q.untrack(entry)
+					q.add(request)
 				}
-			} else {
-				cond.Wait()
+				q.cond.L.Unlock()
+				return
 			}
-			cond.L.Unlock()
 		}
 	}()
 
@@ -59,28 +134,307 @@ func (q *memoryWorkerQueue) SubscribeRequests(ctx context.Context) (<-chan *arac
 		select {
 		//wait canncel
 		case <-ctx.Done():
-			cond.Signal()
+			q.cond.L.Lock()
+			q.cond.Broadcast()
+			q.cond.L.Unlock()
 		}
 	}()
 
 	return requestChan, nil
 }
+
+// next waits for the request with the smallest priority and marks it in flight
+// so that it is regarded as pending until it is delivered.
+// It returns nil when ctx is done.
+func (q *memoryWorkerQueue) next(ctx context.Context) *arachne.Request {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		now := time.Now()
+		q.promote(now)
+		node := q.popMin(now)
+		if node == nil {
+			q.scheduleWakeUp()
+			q.cond.Wait()
+			continue
+		}
+		request, ok := node.Value.(*arachne.Request)
+		if !ok {
+			continue
+		}
+		if q.inflight == nil {
+			q.inflight = map[string]*inflightRequest{}
+		}
+		fingerprint := arachne.Fingerprint(request)
+		q.inflight[fingerprint] = &inflightRequest{request: request, fingerprint: fingerprint}
+		q.hostDelivered(request, now)
+		return request
+	}
+}
+
 func (q *memoryWorkerQueue) RetryRequest(request *arachne.Request) error {
-	cond.L.Lock()
-	defer cond.L.Unlock()
-	if q.queue.GetByKey(request.URL) == nil {
-		q.queue.AddOrUpdate(request.URL, sortedset.SCORE(request.Priority), request)
-		cond.Signal()
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.release(request) {
+		q.add(request)
+		return nil
 	}
-	return nil
+	return q.push(request)
 }
 
 func (q *memoryWorkerQueue) PublishRequest(request *arachne.Request) error {
-	cond.L.Lock()
-	defer cond.L.Unlock()
-	if q.queue.GetByKey(request.URL) == nil {
-		q.queue.AddOrUpdate(request.URL, sortedset.SCORE(request.Priority), request)
-		cond.Signal()
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.dupeFilter == nil || q.isPending(arachne.Fingerprint(request)) {
+		return q.push(request)
+	}
+	seen, err := q.dupeFilter.Seen(request)
+	if err != nil {
+		return xerrors.Errorf("fail to filter request %s: %w", request.URL, err)
+	}
+	if seen {
+		return nil
+	}
+	err = q.push(request)
+	if err != nil {
+		return err
+	}
+	err = q.dupeFilter.Record(request)
+	if err != nil {
+		return xerrors.Errorf("fail to record request %s: %w", request.URL, err)
+	}
+	return nil
+}
+
+// Ack removes the request from the in-flight requests.
+// It ignores the delivery whose visibility timeout has expired because the request is delivered again.
+func (q *memoryWorkerQueue) Ack(request *arachne.Request) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.forgetExpired(request) {
+		return nil
+	}
+	if q.release(request) && q.journal != nil {
+		q.journal.consumed(request)
+	}
+	return nil
+}
+
+// Nack puts the request back to the queue.
+// It ignores the delivery whose visibility timeout has expired because the request is delivered again.
+func (q *memoryWorkerQueue) Nack(request *arachne.Request) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.forgetExpired(request) {
+		return nil
+	}
+	if q.release(request) {
+		q.add(request)
+		return nil
+	}
+	return q.push(request)
+}
+
+// PendingRequests returns the queued, in-flight and delayed requests.
+func (q *memoryWorkerQueue) PendingRequests() ([]*arachne.Request, error) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.pending(), nil
+}
+
+// PublishDeadLetter stores the dead letter.
+func (q *memoryWorkerQueue) PublishDeadLetter(letter *arachne.DeadLetter) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.journal != nil {
+		err := q.journal.deadLettered(letter)
+		if err != nil {
+			return xerrors.Errorf("fail to journal dead letter %s: %w", letter.Request.URL, err)
+		}
+	}
+	q.bury(letter)
+	return nil
+}
+
+// DeadLetters returns the stored dead letters in the order of url.
+func (q *memoryWorkerQueue) DeadLetters() ([]*arachne.DeadLetter, error) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	fingerprints := make(map[*arachne.DeadLetter]string, len(q.deadLetters))
+	letters := make([]*arachne.DeadLetter, 0, len(q.deadLetters))
+	for fingerprint, letter := range q.deadLetters {
+		fingerprints[letter] = fingerprint
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].Request.URL != letters[j].Request.URL {
+			return letters[i].Request.URL < letters[j].Request.URL
+		}
+		return fingerprints[letters[i]] < fingerprints[letters[j]]
+	})
+	return letters, nil
+}
+
+// DeadLetter returns the dead letter of the request with the fingerprint, or nil if it does not exist.
+func (q *memoryWorkerQueue) DeadLetter(fingerprint string) (*arachne.DeadLetter, error) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.deadLetters[fingerprint], nil
+}
+
+// ReinjectDeadLetter removes the dead letter of the request with the fingerprint and publishes its request again.
+func (q *memoryWorkerQueue) ReinjectDeadLetter(fingerprint string) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	letter, ok := q.deadLetters[fingerprint]
+	if !ok {
+		return xerrors.Errorf("dead letter %s does not exist", fingerprint)
+	}
+	if q.journal != nil {
+		err := q.journal.reinjected(letter)
+		if err != nil {
+			return xerrors.Errorf("fail to journal reinjection %s: %w", letter.Request.URL, err)
+		}
+	}
+	delete(q.deadLetters, fingerprint)
+	letter.Request.Attempts = 0
+	return q.push(letter.Request)
+}
+
+// bury stores the dead letter by the fingerprint of its request without journaling. cond.L must be held.
+func (q *memoryWorkerQueue) bury(letter *arachne.DeadLetter) {
+	if q.deadLetters == nil {
+		q.deadLetters = map[string]*arachne.DeadLetter{}
+	}
+	q.deadLetters[arachne.Fingerprint(letter.Request)] = letter
+}
+
+// push adds request unless a request with the same fingerprint is pending. cond.L must be held.
+func (q *memoryWorkerQueue) push(request *arachne.Request) error {
+	if q.isPending(arachne.Fingerprint(request)) {
+		return nil
+	}
+	if q.journal != nil {
+		err := q.journal.published(request)
+		if err != nil {
+			return xerrors.Errorf("fail to journal request %s: %w", request.URL, err)
+		}
 	}
+	q.add(request)
 	return nil
 }
+
+// isPending reports whether a request with the fingerprint is queued, in flight or delayed. cond.L must be held.
+func (q *memoryWorkerQueue) isPending(fingerprint string) bool {
+	if q.queued(fingerprint) != nil {
+		return true
+	}
+	if _, ok := q.inflight[fingerprint]; ok {
+		return true
+	}
+	return q.delayedKeys[fingerprint]
+}
+
+// add adds request to the queue without journaling,
+// or withholds it until Request.NotBefore. cond.L must be held.
+func (q *memoryWorkerQueue) add(request *arachne.Request) {
+	if request.NotBefore.After(time.Now()) {
+		q.delay(request)
+		// wake subscribers up to reschedule their wake-up
+		q.cond.Broadcast()
+		return
+	}
+	q.enqueue(request)
+}
+
+// delivered starts the visibility timeout of the delivered request,
+// or regards it as consumed if the visibility timeout is disabled. cond.L must be held.
+func (q *memoryWorkerQueue) delivered(request *arachne.Request) {
+	entry, ok := q.inflight[arachne.Fingerprint(request)]
+	if !ok || entry.request != request {
+		// the request is put back by Nack or RetryRequest before the delivery completes.
+		return
+	}
+	if q.visibilityTimeout <= 0 {
+		q.untrack(entry)
+		if q.journal != nil {
+			q.journal.consumed(request)
+		}
+		return
+	}
+	entry.timer = time.AfterFunc(q.visibilityTimeout, func() {
+		q.cond.L.Lock()
+		defer q.cond.L.Unlock()
+		if q.inflight[entry.fingerprint] == entry {
+			q.untrack(entry)
+			if q.expired == nil {
+				q.expired = map[*arachne.Request]bool{}
+			}
+			q.expired[request] = true
+			// the next delivery is a copy so that the late ack of this delivery is told apart.
+			q.add(copyRequest(request))
+		}
+	})
+}
+
+// forgetExpired reports whether the delivery of request has expired, and forgets it. cond.L must be held.
+func (q *memoryWorkerQueue) forgetExpired(request *arachne.Request) bool {
+	if !q.expired[request] {
+		return false
+	}
+	delete(q.expired, request)
+	return true
+}
+
+// copyRequest returns a copy of request that shares no header, body or meta with it,
+// because the subscriber of the expired delivery may still modify them.
+func copyRequest(request *arachne.Request) *arachne.Request {
+	o := *request
+	o.Header = make(http.Header, len(request.Header))
+	for key, values := range request.Header {
+		o.Header[key] = append([]string(nil), values...)
+	}
+	o.Body = append([]byte(nil), request.Body...)
+	o.Meta = make(map[string]interface{}, len(request.Meta))
+	for key, value := range request.Meta {
+		o.Meta[key] = value
+	}
+	return &o
+}
+
+// release removes the in-flight request with the same fingerprint as request, and reports whether it exists.
+// cond.L must be held.
+func (q *memoryWorkerQueue) release(request *arachne.Request) bool {
+	entry, ok := q.inflight[arachne.Fingerprint(request)]
+	if !ok {
+		return false
+	}
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	q.untrack(entry)
+	return true
+}
+
+// untrack removes the in-flight entry. cond.L must be held.
+func (q *memoryWorkerQueue) untrack(entry *inflightRequest) {
+	delete(q.inflight, entry.fingerprint)
+	q.hostDone(entry.request)
+}
+
+// pending returns requests that are not consumed yet, that is, queued requests of each queue in the order of priority
+// followed by in-flight requests and delayed requests. cond.L must be held.
+func (q *memoryWorkerQueue) pending() []*arachne.Request {
+	requests := make([]*arachne.Request, 0, q.queuedCount()+len(q.inflight)+len(q.delayed))
+	requests = append(requests, q.queuedRequests()...)
+	for _, entry := range q.inflight {
+		requests = append(requests, entry.request)
+	}
+	requests = append(requests, q.delayed...)
+	return requests
+}
@@ -2,12 +2,14 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/getumen/arachne"
+	"github.com/golang/mock/gomock"
 	"github.com/wangjia184/sortedset"
 )
 
@@ -16,6 +18,7 @@ func TestMemoryWorkerQueue_SubscribeRequests(t *testing.T) {
 	ctx, cancelFunc := context.WithCancel(ctx)
 
 	q := memoryWorkerQueue{
+		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: sortedset.New(),
 	}
 	num := 1000
@@ -23,10 +26,10 @@ func TestMemoryWorkerQueue_SubscribeRequests(t *testing.T) {
 	go func() {
 		for i := 0; i < num; i++ {
 			r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
-			cond.L.Lock()
+			q.cond.L.Lock()
 			q.queue.AddOrUpdate(r.URL, sortedset.SCORE(r.Priority), r)
-			cond.Signal()
-			cond.L.Unlock()
+			q.cond.Signal()
+			q.cond.L.Unlock()
 		}
 		cancelFunc()
 	}()
@@ -43,11 +46,11 @@ func TestMemoryWorkerQueue_SubscribeRequests(t *testing.T) {
 		}
 		counter++
 	}
-	cond.L.Lock()
+	q.cond.L.Lock()
 	if counter+q.queue.GetCount() != num {
 		t.Fatalf("expected %d, but got %d. some request missing.", num, counter+q.queue.GetCount())
 	}
-	cond.L.Unlock()
+	q.cond.L.Unlock()
 }
 
 func TestMemoryWorkerQueue_SubscribeRequestsSlowPublication(t *testing.T) {
@@ -55,6 +58,7 @@ func TestMemoryWorkerQueue_SubscribeRequestsSlowPublication(t *testing.T) {
 	ctx, cancelFunc := context.WithCancel(ctx)
 
 	q := memoryWorkerQueue{
+		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: sortedset.New(),
 	}
 	num := 1000
@@ -62,10 +66,10 @@ func TestMemoryWorkerQueue_SubscribeRequestsSlowPublication(t *testing.T) {
 	go func() {
 		for i := 0; i < num; i++ {
 			r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
-			cond.L.Lock()
+			q.cond.L.Lock()
 			q.queue.AddOrUpdate(r.URL, sortedset.SCORE(r.Priority), r)
-			cond.Signal()
-			cond.L.Unlock()
+			q.cond.Signal()
+			q.cond.L.Unlock()
 			time.Sleep(1 * time.Microsecond)
 		}
 		cancelFunc()
@@ -83,11 +87,11 @@ func TestMemoryWorkerQueue_SubscribeRequestsSlowPublication(t *testing.T) {
 		}
 		counter++
 	}
-	cond.L.Lock()
+	q.cond.L.Lock()
 	if counter+q.queue.GetCount() != num {
 		t.Fatalf("expected %d, but got %d. some request missing.", num, counter+q.queue.GetCount())
 	}
-	cond.L.Unlock()
+	q.cond.L.Unlock()
 }
 
 func TestMemoryWorkerQueue_SubscribeRequestsNoPublication(t *testing.T) {
@@ -95,6 +99,7 @@ func TestMemoryWorkerQueue_SubscribeRequestsNoPublication(t *testing.T) {
 	ctx, cancelFunc := context.WithCancel(ctx)
 
 	q := memoryWorkerQueue{
+		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: sortedset.New(),
 	}
 	num := 0
@@ -102,10 +107,10 @@ func TestMemoryWorkerQueue_SubscribeRequestsNoPublication(t *testing.T) {
 	go func() {
 		for i := 0; i < num; i++ {
 			r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%d", i))
-			cond.L.Lock()
+			q.cond.L.Lock()
 			q.queue.AddOrUpdate(r.URL, sortedset.SCORE(r.Priority), r)
-			cond.Signal()
-			cond.L.Unlock()
+			q.cond.Signal()
+			q.cond.L.Unlock()
 		}
 		cancelFunc()
 	}()
@@ -122,16 +127,17 @@ func TestMemoryWorkerQueue_SubscribeRequestsNoPublication(t *testing.T) {
 		}
 		counter++
 	}
-	cond.L.Lock()
+	q.cond.L.Lock()
 	if counter+q.queue.GetCount() != num {
 		t.Fatalf("expected %d, but got %d. some request missing.", num, counter+q.queue.GetCount())
 	}
-	cond.L.Unlock()
+	q.cond.L.Unlock()
 }
 
 func TestMemoryWorkerQueue_RetryRequest(t *testing.T) {
 
 	q := memoryWorkerQueue{
+		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: sortedset.New(),
 	}
 	wg := sync.WaitGroup{}
@@ -155,6 +161,7 @@ func TestMemoryWorkerQueue_RetryRequest(t *testing.T) {
 func TestMemoryWorkerQueue_PublishRequest(t *testing.T) {
 
 	q := memoryWorkerQueue{
+		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: sortedset.New(),
 	}
 	wg := sync.WaitGroup{}
@@ -174,3 +181,313 @@ func TestMemoryWorkerQueue_PublishRequest(t *testing.T) {
 		t.Fatalf("expected %d, but got %d", 100, q.queue.GetCount())
 	}
 }
+
+func TestMemoryWorkerQueue_VisibilityTimeout(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithVisibilityTimeout(10 * time.Millisecond))
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+
+	acked, _ := arachne.NewGetRequest("https://golang.org/acked")
+	q.PublishRequest(acked)
+	request := <-ch
+	if request.URL != acked.URL {
+		t.Fatalf("expected %s, but got %s", acked.URL, request.URL)
+	}
+	q.Ack(request)
+
+	expired, _ := arachne.NewGetRequest("https://golang.org/expired")
+	q.PublishRequest(expired)
+	request = <-ch
+	// in-flight request is not published twice
+	q.PublishRequest(expired)
+	request = <-ch
+	if request.URL != expired.URL {
+		t.Fatalf("expected %s, but got %s", expired.URL, request.URL)
+	}
+	q.Nack(request)
+	request = <-ch
+	if request.URL != expired.URL {
+		t.Fatalf("expected %s, but got %s", expired.URL, request.URL)
+	}
+	q.Ack(request)
+
+	time.Sleep(50 * time.Millisecond)
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.queue.GetCount() != 0 || len(q.inflight) != 0 {
+		t.Fatalf("expected no pending request, but got %d queued and %d in-flight", q.queue.GetCount(), len(q.inflight))
+	}
+}
+
+func TestMemoryWorkerQueue_VisibilityTimeoutLateAck(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithVisibilityTimeout(200 * time.Millisecond))
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+
+	acked, _ := arachne.NewGetRequest("https://golang.org/acked")
+	nacked, _ := arachne.NewGetRequest("https://golang.org/nacked")
+	q.PublishRequest(acked)
+	q.PublishRequest(nacked)
+	expired := map[string]*arachne.Request{}
+	redelivered := map[string]*arachne.Request{}
+	for i := 0; i < 4; i++ {
+		request := <-ch
+		if expired[request.URL] == nil {
+			expired[request.URL] = request
+		} else {
+			redelivered[request.URL] = request
+		}
+	}
+	for url, request := range redelivered {
+		if request == expired[url] {
+			t.Fatalf("expected another delivery of %s, but got the same", url)
+		}
+	}
+
+	// the late ack and nack of the expired deliveries do not affect the redeliveries
+	q.Ack(expired[acked.URL])
+	q.Nack(expired[nacked.URL])
+	q.cond.L.Lock()
+	for url, request := range redelivered {
+		entry := q.inflight[arachne.Fingerprint(request)]
+		if entry == nil || entry.request != request {
+			q.cond.L.Unlock()
+			t.Fatalf("expected the redelivery of %s in flight, but got %v", url, entry)
+		}
+	}
+	if q.queue.GetCount() != 0 || len(q.expired) != 0 {
+		q.cond.L.Unlock()
+		t.Fatalf("expected no queued or expired request, but got %d and %d", q.queue.GetCount(), len(q.expired))
+	}
+	q.cond.L.Unlock()
+
+	for _, request := range redelivered {
+		q.Ack(request)
+	}
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if len(q.inflight) != 0 {
+		t.Fatalf("expected no in-flight request, but got %d", len(q.inflight))
+	}
+}
+
+func TestMemoryWorkerQueue_DeadLetter(t *testing.T) {
+	q := newMemoryWorkerQueue()
+
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+	r.Attempts = 3
+	q.PublishDeadLetter(&arachne.DeadLetter{Request: r, StatusCode: 429, Error: "too many requests"})
+
+	letters, _ := q.DeadLetters()
+	if len(letters) != 1 || letters[0].StatusCode != 429 {
+		t.Fatalf("unexpected dead letters: %v", letters)
+	}
+	letter, _ := q.DeadLetter(arachne.Fingerprint(r))
+	if letter == nil || letter.Error != "too many requests" {
+		t.Fatalf("unexpected dead letter: %v", letter)
+	}
+
+	if err := q.ReinjectDeadLetter(arachne.Fingerprint(r)); err != nil {
+		t.Fatalf("fail to reinject: %v", err)
+	}
+	if err := q.ReinjectDeadLetter(arachne.Fingerprint(r)); err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+	request := q.queued(arachne.Fingerprint(r))
+	if request == nil || request.Attempts != 0 {
+		t.Fatalf("dead letter is not reinjected")
+	}
+}
+
+func TestMemoryWorkerQueue_DeadLetterSameURL(t *testing.T) {
+	q := newMemoryWorkerQueue()
+
+	// requests with the same url but different bodies are different dead letters
+	for _, body := range []string{"a=1", "a=2"} {
+		r, _ := arachne.NewGetRequest("https://golang.org/search")
+		r.Method = "POST"
+		r.Body = []byte(body)
+		q.PublishDeadLetter(&arachne.DeadLetter{Request: r, StatusCode: 500})
+	}
+	letters, _ := q.DeadLetters()
+	if len(letters) != 2 {
+		t.Fatalf("expected %d dead letters, but got %v", 2, letters)
+	}
+}
+
+func TestMemoryWorkerQueue_NotBefore(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue()
+
+	notBefore := time.Now().Add(50 * time.Millisecond)
+	for i, u := range []string{"https://golang.org/later", "https://golang.org/sooner"} {
+		r, _ := arachne.NewGetRequest(u)
+		r.NotBefore = notBefore
+		r.Priority = int64(-i)
+		q.PublishRequest(r)
+		// delayed request is not published twice
+		q.PublishRequest(r)
+	}
+	r, _ := arachne.NewGetRequest("https://golang.org/ready")
+	r.Priority = 10
+	q.PublishRequest(r)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	for _, expected := range []string{
+		"https://golang.org/ready",
+		"https://golang.org/sooner",
+		"https://golang.org/later",
+	} {
+		request := <-ch
+		if request.URL != expected {
+			t.Fatalf("expected %s, but got %s", expected, request.URL)
+		}
+		if request.URL != "https://golang.org/ready" && time.Now().Before(notBefore) {
+			t.Fatalf("%s is delivered before %v", request.URL, notBefore)
+		}
+	}
+}
+
+func TestMemoryWorkerQueue_PublishRequestFingerprint(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue()
+	a, _ := arachne.NewGetRequest("http://a.com/x?b=1&a=2")
+	b, _ := arachne.NewGetRequest("http://A.com/x?a=2&b=1#frag")
+	c, _ := arachne.NewGetRequest("http://a.com/form")
+	c.Method = "POST"
+	c.Body = []byte("page=1")
+	d, _ := arachne.NewGetRequest("http://a.com/form")
+	d.Method = "POST"
+	d.Body = []byte("page=2")
+	for _, r := range []*arachne.Request{a, b, c, d} {
+		q.PublishRequest(r)
+	}
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	received := map[*arachne.Request]bool{}
+	for i := 0; i < 3; i++ {
+		received[<-ch] = true
+	}
+	for _, expected := range []*arachne.Request{a, c, d} {
+		if !received[expected] {
+			t.Fatalf("expected %s %s, but it is not delivered", expected.URL, expected.Body)
+		}
+	}
+	select {
+	case request := <-ch:
+		t.Fatalf("expected no more requests, but got %s", request.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryWorkerQueue_DupeFilter(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	filter := arachne.NewMockDupeFilter(ctrl)
+
+	q := newMemoryWorkerQueue(WithDupeFilter(filter))
+	a, _ := arachne.NewGetRequest("https://golang.org/a")
+	b, _ := arachne.NewGetRequest("https://golang.org/b")
+	filter.EXPECT().Seen(a).Return(true, nil)
+	filter.EXPECT().Seen(b).Return(false, nil)
+	filter.EXPECT().Record(b).Return(nil)
+	q.PublishRequest(a)
+	q.PublishRequest(b)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	if request := <-ch; request != b {
+		t.Fatalf("expected %s, but got %s", b.URL, request.URL)
+	}
+	// a retried request is not filtered.
+	err = q.RetryRequest(b)
+	if err != nil {
+		t.Fatalf("fail to retry: %v", err)
+	}
+	if request := <-ch; request != b {
+		t.Fatalf("expected %s, but got %s", b.URL, request.URL)
+	}
+}
+
+// failingJournal is a journal that fails to write.
+type failingJournal struct{}
+
+func (failingJournal) published(request *arachne.Request) error {
+	return errors.New("error")
+}
+
+func (failingJournal) consumed(request *arachne.Request) {}
+
+func (failingJournal) deadLettered(letter *arachne.DeadLetter) error {
+	return errors.New("error")
+}
+
+func (failingJournal) reinjected(letter *arachne.DeadLetter) error {
+	return errors.New("error")
+}
+
+func TestMemoryWorkerQueue_DupeFilterFailToPush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	filter := arachne.NewMockDupeFilter(ctrl)
+
+	q := newMemoryWorkerQueue(WithDupeFilter(filter))
+	q.journal = failingJournal{}
+	r, _ := arachne.NewGetRequest("https://golang.org/")
+	// the request is not recorded, so it can be published again
+	filter.EXPECT().Seen(r).Return(false, nil)
+	filter.EXPECT().Record(r).Times(0)
+	err := q.PublishRequest(r)
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+}
+
+func TestMemoryWorkerQueue_IndependentInstances(t *testing.T) {
+	first := newMemoryWorkerQueue()
+	second := newMemoryWorkerQueue()
+
+	// a queue that is busy does not block another queue
+	first.cond.L.Lock()
+	defer first.cond.L.Unlock()
+
+	done := make(chan error)
+	go func() {
+		r, _ := arachne.NewGetRequest("https://golang.org/")
+		done <- second.PublishRequest(r)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fail to publish request: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the queues not to share the lock")
+	}
+}
@@ -0,0 +1,288 @@
+package queue
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/getumen/arachne"
+	"github.com/wangjia184/sortedset"
+)
+
+// defaultQueueName is the name of the queue for requests without Request.QueueName.
+const defaultQueueName = "default"
+
+// WithQueueWeights makes SubscribeRequests draw from the named queues in proportion to weights
+// by smooth weighted round-robin. A queue that is not in weights has weight 1.
+// Without this option and WithStrictQueuePriority, every named queue has the same weight.
+func WithQueueWeights(weights map[string]int) Option {
+	return func(q *memoryWorkerQueue) {
+		q.weights = weights
+	}
+}
+
+// WithStrictQueuePriority makes SubscribeRequests draw from the first non-empty queue of names.
+// Queues that are not in names are drawn after them in the order of name.
+func WithStrictQueuePriority(names ...string) Option {
+	return func(q *memoryWorkerQueue) {
+		q.strictOrder = names
+	}
+}
+
+// namedQueue is the requests of a Request.QueueName.
+// The requests are sharded by host with host sharding, or kept in the shard "" otherwise.
+// The key of each non-empty shard is scheduled in one of ready, waiting and blocked by the state of its host.
+// A scheduled key stays there when its shard is emptied or its host stops being ready,
+// and is rescheduled when it is taken out.
+type namedQueue struct {
+	shards map[string]*sortedset.SortedSet
+	// ready is the FIFO of the keys in the order of round-robin.
+	ready []string
+	// waiting is the keys whose host waits for its delay, in the order of the time when it is ready.
+	waiting hostWaits
+	// blocked is the keys whose host has the maximum number of requests in flight.
+	blocked map[string]bool
+	// scheduled is the keys in ready, waiting or blocked.
+	scheduled map[string]bool
+}
+
+// namedQueue returns the queue of the name. cond.L must be held.
+func (q *memoryWorkerQueue) namedQueue(name string) *namedQueue {
+	if name == "" {
+		name = defaultQueueName
+	}
+	if q.queues == nil {
+		q.queues = map[string]*namedQueue{}
+	}
+	named, ok := q.queues[name]
+	if !ok {
+		named = &namedQueue{
+			shards:    map[string]*sortedset.SortedSet{},
+			blocked:   map[string]bool{},
+			scheduled: map[string]bool{},
+		}
+		if name == defaultQueueName {
+			// the shard "" of the default queue is memoryWorkerQueue.queue and never removed.
+			if q.queue == nil {
+				q.queue = sortedset.New()
+			}
+			named.shards[""] = q.queue
+		}
+		q.queues[name] = named
+		i := sort.SearchStrings(q.names, name)
+		q.names = append(q.names, "")
+		copy(q.names[i+1:], q.names[i:])
+		q.names[i] = name
+	}
+	return named
+}
+
+// shard returns the shard of the key in the named queue. cond.L must be held.
+func (q *memoryWorkerQueue) shard(named *namedQueue, key string) *sortedset.SortedSet {
+	set, ok := named.shards[key]
+	if !ok {
+		set = sortedset.New()
+		named.shards[key] = set
+	}
+	return set
+}
+
+// removeShardIfEmpty removes the empty shard of the key from the named queue. cond.L must be held.
+func (q *memoryWorkerQueue) removeShardIfEmpty(named *namedQueue, key string) {
+	set := named.shards[key]
+	if set == nil || set.GetCount() > 0 || set == q.queue {
+		return
+	}
+	delete(named.shards, key)
+}
+
+// schedule puts the key of a shard in ready, waiting or blocked by the state of its host,
+// or forgets the key if the shard is empty. The key must not be in any of them. cond.L must be held.
+func (q *memoryWorkerQueue) schedule(named *namedQueue, key string, now time.Time) {
+	if set := named.shards[key]; set == nil || set.GetCount() == 0 {
+		delete(named.scheduled, key)
+		q.removeShardIfEmpty(named, key)
+		return
+	}
+	named.scheduled[key] = true
+	switch {
+	case q.hostReady(key, now):
+		named.ready = append(named.ready, key)
+	case q.maxInFlightPerHost > 0 && q.hosts[key].inFlight >= q.maxInFlightPerHost:
+		named.blocked[key] = true
+	default:
+		heap.Push(&named.waiting, hostWait{key: key, readyAt: q.hosts[key].readyAt})
+	}
+}
+
+// unblock reschedules the blocked keys of the host in every named queue. cond.L must be held.
+func (q *memoryWorkerQueue) unblock(host string, now time.Time) {
+	for _, named := range q.queues {
+		if named.blocked[host] {
+			delete(named.blocked, host)
+			q.schedule(named, host, now)
+		}
+	}
+}
+
+// queueNames returns the names of the queues in the order of name. cond.L must be held.
+func (q *memoryWorkerQueue) queueNames() []string {
+	q.namedQueue(defaultQueueName)
+	return q.names
+}
+
+// queued returns the queued request of the fingerprint, or nil. cond.L must be held.
+func (q *memoryWorkerQueue) queued(fingerprint string) *arachne.Request {
+	return q.index[fingerprint]
+}
+
+// shardEntryKey returns the key of the request in its shard.
+// Requests with the same priority are ordered by url.
+func shardEntryKey(request *arachne.Request, fingerprint string) string {
+	return request.URL + "\x00" + fingerprint
+}
+
+// enqueue adds request to its shard. cond.L must be held.
+func (q *memoryWorkerQueue) enqueue(request *arachne.Request) {
+	if q.index == nil {
+		q.index = map[string]*arachne.Request{}
+	}
+	fingerprint := arachne.Fingerprint(request)
+	named := q.namedQueue(request.QueueName)
+	key := q.shardKey(request)
+	if q.shard(named, key).AddOrUpdate(shardEntryKey(request, fingerprint), sortedset.SCORE(request.Priority), request) {
+		q.queuedNum++
+	}
+	if !named.scheduled[key] {
+		q.schedule(named, key, time.Now())
+	}
+	q.index[fingerprint] = request
+	// wake up the subscribers
+	q.cond.Broadcast()
+}
+
+// dequeue removes the queued request of the fingerprint. cond.L must be held.
+func (q *memoryWorkerQueue) dequeue(fingerprint string) {
+	request := q.queued(fingerprint)
+	if request == nil {
+		return
+	}
+	delete(q.index, fingerprint)
+	named := q.namedQueue(request.QueueName)
+	key := q.shardKey(request)
+	if set, ok := named.shards[key]; ok {
+		if set.Remove(shardEntryKey(request, fingerprint)) != nil {
+			q.queuedNum--
+		}
+		q.removeShardIfEmpty(named, key)
+	}
+}
+
+// queuedRequests returns the queued requests of each queue in the order of priority. cond.L must be held.
+func (q *memoryWorkerQueue) queuedRequests() []*arachne.Request {
+	requests := make([]*arachne.Request, 0, q.queuedCount())
+	for _, name := range q.queueNames() {
+		named := q.queues[name]
+		keys := make([]string, 0, len(named.shards))
+		for key := range named.shards {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, node := range named.shards[key].GetByRankRange(1, -1, false) {
+				if request, ok := node.Value.(*arachne.Request); ok {
+					requests = append(requests, request)
+				}
+			}
+		}
+	}
+	return requests
+}
+
+// queuedCount returns the number of queued requests without walking the shards. cond.L must be held.
+func (q *memoryWorkerQueue) queuedCount() int {
+	return q.queuedNum
+}
+
+// popMin chooses a queue by the weights or the strict priority,
+// and removes and returns the request with the smallest priority in the next ready shard of the queue.
+// cond.L must be held.
+func (q *memoryWorkerQueue) popMin(now time.Time) *sortedset.SortedSetNode {
+	names := make([]string, 0, len(q.queues))
+	for _, name := range q.queueNames() {
+		if _, ok := q.readyShard(q.queues[name], now); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	var name string
+	if q.strictOrder != nil {
+		name = q.strictChoice(names)
+	} else {
+		name = q.weightedChoice(names)
+	}
+	named := q.queues[name]
+	key, _ := q.readyShard(named, now)
+	named.ready = named.ready[1:]
+	node := named.shards[key].PopMin()
+	q.queuedNum--
+	if request, ok := node.Value.(*arachne.Request); ok {
+		delete(q.index, arachne.Fingerprint(request))
+	}
+	// the key goes to the back of the round-robin, or is forgotten if the shard is empty.
+	q.schedule(named, key, now)
+	return node
+}
+
+// readyShard returns the key of the next non-empty shard whose host is ready.
+// It reschedules the waiting keys whose time has come and the keys at the head of ready that are not ready.
+// cond.L must be held.
+func (q *memoryWorkerQueue) readyShard(named *namedQueue, now time.Time) (string, bool) {
+	for len(named.waiting) > 0 && !named.waiting[0].readyAt.After(now) {
+		q.schedule(named, heap.Pop(&named.waiting).(hostWait).key, now)
+	}
+	for len(named.ready) > 0 {
+		key := named.ready[0]
+		if set := named.shards[key]; set != nil && set.GetCount() > 0 && q.hostReady(key, now) {
+			return key, true
+		}
+		named.ready = named.ready[1:]
+		q.schedule(named, key, now)
+	}
+	return "", false
+}
+
+func (q *memoryWorkerQueue) strictChoice(names []string) string {
+	for _, name := range q.strictOrder {
+		for _, candidate := range names {
+			if name == candidate {
+				return name
+			}
+		}
+	}
+	return names[0]
+}
+
+// weightedChoice chooses one of names by smooth weighted round-robin.
+func (q *memoryWorkerQueue) weightedChoice(names []string) string {
+	if q.credits == nil {
+		q.credits = map[string]int{}
+	}
+	total := 0
+	chosen := ""
+	for _, name := range names {
+		weight, ok := q.weights[name]
+		if !ok {
+			weight = 1
+		}
+		q.credits[name] += weight
+		total += weight
+		if chosen == "" || q.credits[name] > q.credits[chosen] {
+			chosen = name
+		}
+	}
+	q.credits[chosen] -= total
+	return chosen
+}
@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/getumen/arachne"
+)
+
+func publishTestNamedRequests(q *memoryWorkerQueue, queueName string, num int) {
+	for i := 0; i < num; i++ {
+		r, _ := arachne.NewGetRequest(fmt.Sprintf("https://golang.org/%s/%d", queueName, i))
+		r.QueueName = queueName
+		q.PublishRequest(r)
+	}
+}
+
+func TestMemoryWorkerQueue_queuedCount(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithHostSharding(0, 0))
+	publishTestNamedRequests(q, "detail", 10)
+	publishTestNamedRequests(q, "seeds", 10)
+	r, _ := arachne.NewGetRequest("https://golang.org/other")
+	q.PublishRequest(r)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	for i := 0; i < 5; i++ {
+		<-ch
+	}
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.dequeue(arachne.Fingerprint(r))
+
+	count := 0
+	for _, named := range q.queues {
+		for _, set := range named.shards {
+			count += set.GetCount()
+		}
+	}
+	if q.queuedCount() != count {
+		t.Fatalf("expected %d, but got %d", count, q.queuedCount())
+	}
+}
+
+func TestMemoryWorkerQueue_QueueWeights(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithQueueWeights(map[string]int{"detail": 2}))
+	publishTestNamedRequests(q, "detail", 30)
+	publishTestNamedRequests(q, "pagination", 30)
+	publishTestNamedRequests(q, "seeds", 30)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	counter := map[string]int{}
+	for i := 0; i < 40; i++ {
+		request := <-ch
+		counter[request.QueueName]++
+	}
+	expected := map[string]int{"detail": 20, "pagination": 10, "seeds": 10}
+	for name, count := range expected {
+		if counter[name] != count {
+			t.Fatalf("expected %d requests from %s, but got %d", count, name, counter[name])
+		}
+	}
+}
+
+func TestMemoryWorkerQueue_StrictQueuePriority(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	q := newMemoryWorkerQueue(WithStrictQueuePriority("seeds", "detail"))
+	publishTestNamedRequests(q, "recrawl", 10)
+	publishTestNamedRequests(q, "detail", 10)
+	publishTestNamedRequests(q, "seeds", 10)
+
+	ch, err := q.SubscribeRequests(ctx)
+	if err != nil {
+		t.Fatalf("fail to subscribe")
+	}
+	for _, expected := range []string{"seeds", "detail", "recrawl"} {
+		for i := 0; i < 10; i++ {
+			request := <-ch
+			if request.QueueName != expected {
+				t.Fatalf("expected a request from %s, but got %s", expected, request.QueueName)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package arachne
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// RetryPredicate reports whether the outcome of a fetch should be retried.
+// err is the error of HTTPClient, and response is nil if err is not nil.
+type RetryPredicate func(response *Response, err error) bool
+
+// RetryPolicy decides whether a failed fetch is retried and how long it waits.
+// Worker retries the request through WorkerQueue.RetryRequest with Request.Attempts incremented
+// and Request.NotBefore set to the backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of retries after which the request is sent to the DeadLetterQueue.
+	// Zero means no limit.
+	MaxAttempts int
+	// BaseDelay is the backoff of the first retry. It doubles on each attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff including Retry-After. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the backoff that is randomized, from 0 to 1.
+	Jitter float64
+	// StatusCodes are the status codes that are retried.
+	StatusCodes map[int]bool
+	// Predicates are user-defined rules. The outcome is retried if any of them returns true.
+	Predicates []RetryPredicate
+
+	random func() float64
+}
+
+// NewRetryPolicy creates RetryPolicy that retries network errors, timeouts, 429 and 5xx 3 times
+// with backoff from 1 second up to 1 minute and full jitter.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		Jitter:      1,
+		StatusCodes: map[int]bool{
+			http.StatusTooManyRequests:     true,
+			http.StatusInternalServerError: true,
+			http.StatusBadGateway:          true,
+			http.StatusServiceUnavailable:  true,
+			http.StatusGatewayTimeout:      true,
+		},
+	}
+}
+
+// AddPredicate appends the rule to retry outcomes.
+func (p *RetryPolicy) AddPredicate(predicate RetryPredicate) *RetryPolicy {
+	p.Predicates = append(p.Predicates, predicate)
+	return p
+}
+
+// Classify returns why the outcome should be retried, or "" if it should not.
+func (p *RetryPolicy) Classify(response *Response, err error) string {
+	for _, predicate := range p.Predicates {
+		if predicate(response, err) {
+			return "retry predicate"
+		}
+	}
+	if err != nil {
+		if xerrors.Is(err, context.Canceled) {
+			return ""
+		}
+		var netErr net.Error
+		if xerrors.Is(err, context.DeadlineExceeded) || (xerrors.As(err, &netErr) && netErr.Timeout()) {
+			return "timeout"
+		}
+		return "network error"
+	}
+	if response != nil && p.StatusCodes[response.StatusCode] {
+		return fmt.Sprintf("status %d", response.StatusCode)
+	}
+	return ""
+}
+
+// Backoff returns how long the request waits before its next attempt.
+// The Retry-After header of the response is honored if it exists.
+func (p *RetryPolicy) Backoff(request *Request, response *Response, now time.Time) time.Duration {
+	if response != nil {
+		if delay, ok := parseRetryAfter(response.Headers.Get("Retry-After"), now); ok {
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return delay
+		}
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(request.Attempts))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	random := p.random
+	if random == nil {
+		random = rand.Float64
+	}
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay *= 1 - jitter*random()
+	// float64(math.MaxInt64) is rounded up, so a delay equal to it does not fit in time.Duration either.
+	if delay >= float64(math.MaxInt64) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+// parseRetryAfter parses the value of the Retry-After header, either seconds or an HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if date.Before(now) {
+		return 0, true
+	}
+	return date.Sub(now), true
+}
+
+// retry sends the request back to the WorkerQueue if RetryPolicy classifies the outcome of its fetch as retryable,
+// and reports whether it is done with the request.
+func (w *Worker) retry(request *Request, response *Response, fetchErr error) bool {
+	if w.RetryPolicy == nil {
+		return false
+	}
+	if fetchErr != nil {
+		// ignore the dummy response
+		response = nil
+	}
+	cause := w.RetryPolicy.Classify(response, fetchErr)
+	if cause == "" {
+		return false
+	}
+	statusCode := 0
+	if response != nil {
+		statusCode = response.StatusCode
+	}
+
+	retryRequest := request.clone()
+	retryRequest.Attempts++
+	// keep the failure for the dead letter of a later attempt
+	retryRequest.Meta["status_code"] = statusCode
+	retryRequest.Meta["error"] = cause
+	if w.RetryPolicy.MaxAttempts > 0 && retryRequest.Attempts > w.RetryPolicy.MaxAttempts {
+		w.deadLetter(retryRequest, statusCode, cause)
+		w.acknowledge(request, true)
+		return true
+	}
+	now := time.Now()
+	delay := w.RetryPolicy.Backoff(request, response, now)
+	retryRequest.NotBefore = now.Add(delay)
+	w.Logger.Debugf("retry %s after %v: %s", request.URL, delay, cause)
+	err := w.WorkerQueue.RetryRequest(retryRequest)
+	if err != nil {
+		w.Logger.Errorf("fail to retry %s: %v", request.URL, err)
+		w.acknowledge(request, false)
+		return true
+	}
+	w.acknowledge(request, true)
+	return true
+}
@@ -0,0 +1,160 @@
+package arachne
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicy_Classify(t *testing.T) {
+	policy := NewRetryPolicy().AddPredicate(func(response *Response, err error) bool {
+		return response != nil && string(response.Body) == "captcha"
+	})
+
+	for _, c := range []struct {
+		name     string
+		response *Response
+		err      error
+		expected string
+	}{
+		{"network error", nil, errors.New("connection refused"), "network error"},
+		{"timeout", nil, timeoutError{}, "timeout"},
+		{"deadline", nil, context.DeadlineExceeded, "timeout"},
+		{"canceled", nil, context.Canceled, ""},
+		{"503", &Response{StatusCode: 503}, nil, "status 503"},
+		{"429", &Response{StatusCode: 429}, nil, "status 429"},
+		{"404", &Response{StatusCode: 404}, nil, ""},
+		{"200", &Response{StatusCode: 200}, nil, ""},
+		{"predicate", &Response{StatusCode: 200, Body: []byte("captcha")}, nil, "retry predicate"},
+	} {
+		actual := policy.Classify(c.response, c.err)
+		if actual != c.expected {
+			t.Fatalf("%s: expect %q, but got %q", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := NewRetryPolicy()
+	policy.random = func() float64 { return 0.5 }
+	policy.Jitter = 0
+	now := time.Now()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	for attempts, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		request.Attempts = attempts
+		actual := policy.Backoff(request, nil, now)
+		if actual != expected {
+			t.Fatalf("expect %v, but got %v", expected, actual)
+		}
+	}
+
+	request.Attempts = 10
+	if actual := policy.Backoff(request, nil, now); actual != time.Minute {
+		t.Fatalf("expect the cap %v, but got %v", time.Minute, actual)
+	}
+
+	policy.Jitter = 1
+	request.Attempts = 1
+	if actual := policy.Backoff(request, nil, now); actual != time.Second {
+		t.Fatalf("expect %v with jitter, but got %v", time.Second, actual)
+	}
+
+	// the backoff does not overflow without the cap
+	policy.Jitter = 0
+	policy.MaxDelay = 0
+	for _, attempts := range []int{40, 64, 1000} {
+		request.Attempts = attempts
+		if actual := policy.Backoff(request, nil, now); actual != time.Duration(math.MaxInt64) {
+			t.Fatalf("attempts %d: expect %v, but got %v", attempts, time.Duration(math.MaxInt64), actual)
+		}
+	}
+}
+
+func TestRetryPolicy_BackoffRetryAfter(t *testing.T) {
+	policy := NewRetryPolicy()
+	policy.MaxDelay = 0
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	request, _ := NewGetRequest("https://golang.org/")
+
+	response := &Response{StatusCode: 503, Headers: http.Header{}}
+	response.Headers.Set("Retry-After", "120")
+	if actual := policy.Backoff(request, response, now); actual != 2*time.Minute {
+		t.Fatalf("expect %v, but got %v", 2*time.Minute, actual)
+	}
+
+	response.Headers.Set("Retry-After", now.Add(30*time.Second).Format(http.TimeFormat))
+	if actual := policy.Backoff(request, response, now); actual != 30*time.Second {
+		t.Fatalf("expect %v, but got %v", 30*time.Second, actual)
+	}
+
+	policy.MaxDelay = time.Minute
+	response.Headers.Set("Retry-After", "86400")
+	if actual := policy.Backoff(request, response, now); actual != time.Minute {
+		t.Fatalf("expect the cap %v, but got %v", time.Minute, actual)
+	}
+}
+
+func TestWorker_RetryPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	httpClientMock := NewMockHTTPClient(ctrl)
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Infof(gomock.Any(), gomock.Any()).AnyTimes()
+	workerQueueMock := NewMockDeadLetterQueue(ctrl)
+
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 503, Request: r}, nil
+		},
+	).Times(3)
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).DoAndReturn(
+		func(r *Request) error {
+			if r.Attempts != request.Attempts+1 {
+				t.Fatalf("expect %d attempts, but got %d", request.Attempts+1, r.Attempts)
+			}
+			if r.NotBefore.IsZero() {
+				t.Fatalf("expect NotBefore to be set")
+			}
+			if statusCode, cause := r.lastFailure(); statusCode != 503 || cause != "status 503" {
+				t.Fatalf("expect the failure to be kept, but got %d %s", statusCode, cause)
+			}
+			request = r
+			return nil
+		},
+	).Times(2)
+	workerQueueMock.EXPECT().PublishDeadLetter(gomock.Any()).DoAndReturn(
+		func(letter *DeadLetter) error {
+			if letter.Request.Attempts != 3 || letter.StatusCode != 503 {
+				t.Fatalf("expect 3 attempts and 503, but got %d and %d", letter.Request.Attempts, letter.StatusCode)
+			}
+			return nil
+		},
+	)
+
+	worker := newWorker(workerQueueMock, httpClientMock, loggerMock, nil, nil, nil)
+	worker.RetryPolicy = NewRetryPolicy()
+	worker.RetryPolicy.MaxAttempts = 2
+
+	for i := 0; i < 3; i++ {
+		responses := doRequestOnce(t, worker, request)
+		if len(responses) != 0 {
+			t.Fatalf("expect no response, but got %v", responses)
+		}
+	}
+}
@@ -11,23 +11,42 @@ import (
 
 // DownloadInternet is a sample spider that follows all link in the html.
 func DownloadInternet(response *arachne.Response) ([]*arachne.Request, error) {
-	requests := make([]*arachne.Request, 0)
+	output, err := DownloadInternetItems(response)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range output.Items {
+		fmt.Println(item["title"])
+	}
+	return output.Requests, nil
+}
+
+// DownloadInternetItems is a sample ItemSpider that follows all link in the html
+// and extracts an item with the url and the title of the html.
+func DownloadInternetItems(response *arachne.Response) (*arachne.SpiderOutput, error) {
+	output := &arachne.SpiderOutput{
+		Requests: make([]*arachne.Request, 0),
+		Items:    make([]arachne.Item, 0),
+	}
 	if strings.Contains(response.ContentType(), "text/html") {
 		doc, err := goquery.NewDocumentFromReader(strings.NewReader(response.Text()))
 		if err != nil {
 			log.Printf("fail to parse html in %s", response.Request.URL)
+			return output, nil
 		}
-		title := doc.Find("title").Text()
-		fmt.Println(title)
+		output.Items = append(output.Items, arachne.Item{
+			"url":   response.Request.URL,
+			"title": doc.Find("title").Text(),
+		})
 		doc.Find("a").Each(func(_ int, s *goquery.Selection) {
 			link, exists := s.Attr("href")
 			if exists {
 				request, err := response.FollowRequest(link)
 				if err == nil {
-					requests = append(requests, request)
+					output.Requests = append(output.Requests, request)
 				}
 			}
 		})
 	}
-	return requests, nil
+	return output, nil
 }
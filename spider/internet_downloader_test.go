@@ -25,3 +25,22 @@ func TestDownloaDInternet_SimpleResponse(t *testing.T) {
 		t.Fatalf("expected %s, but got %s", expected, requestList[0].URL)
 	}
 }
+
+func TestDownloadInternetItems_SimpleResponse(t *testing.T) {
+	response := &arachne.Response{}
+	response.Headers = map[string][]string{"Content-Type": {"text/html;utf-8"}}
+	response.Body = []byte("<html><head><title>Test</title></head><body><a href='/doc/'>Documentation</a></body></html>")
+	response.Request = &arachne.Request{}
+	response.Request.URL = "https://golang.org/"
+
+	output, err := DownloadInternetItems(response)
+	if err != nil {
+		t.Fatalf("fail to DownloadInternetItems: %v", err)
+	}
+	if len(output.Requests) != 1 || len(output.Items) != 1 {
+		t.Fatalf("fail to parse html")
+	}
+	if output.Items[0]["title"] != "Test" {
+		t.Fatalf("expected Test, but got %v", output.Items[0]["title"])
+	}
+}
@@ -2,7 +2,9 @@ package arachne
 
 import (
 	"context"
+	"io"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -12,12 +14,51 @@ const channelSize = 16
 
 // Worker handles scheduled requests.
 type Worker struct {
-	WorkerQueue         WorkerQueue
-	HTTPClient          HTTPClient
-	Logger              Logger
+	WorkerQueue WorkerQueue
+	HTTPClient  HTTPClient
+	Logger      Logger
+	// RequestMiddlewares are applied to each request before Middlewares. See AdaptRequestMiddleware.
 	RequestMiddlewares  []func(request *Request)
 	ResponseMiddlewares []func(response *Response)
 	Spider              func(response *Response) ([]*Request, error)
+	// Middlewares are applied to each request in order before it is fetched.
+	Middlewares []RequestMiddleware
+	// DownloaderMiddlewares wrap HTTPClient. The first one is the outermost layer.
+	// They are chained once when the worker starts, so changes while it runs take effect on the next start.
+	DownloaderMiddlewares []DownloaderMiddleware
+	// FetchConcurrency is the number of goroutines that fetch requests. Zero means a goroutine per request.
+	FetchConcurrency int
+	// SpiderConcurrency is the number of goroutines that apply the spider and the item pipelines to responses.
+	// Zero means one. With more than one, the spider and the item pipelines must be safe for concurrent use.
+	SpiderConcurrency int
+	// ItemSpider is used instead of Spider if it is not nil, and its items go through ItemPipelines.
+	ItemSpider ItemSpider
+	// ItemPipelines process each item of ItemSpider in order.
+	ItemPipelines []ItemPipeline
+	// MaxAttempts is the number of retries after which RetryMiddleware gives up a request
+	// and sends it to the DeadLetterQueue. Zero means no limit.
+	MaxAttempts int
+	// RetryPolicy retries the fetches that fail. Nil disables it.
+	RetryPolicy *RetryPolicy
+	// DupeFilter drops requests output by Spider that it has seen before publishing them. Nil disables it.
+	// Retried requests are not filtered.
+	DupeFilter DupeFilter
+	// OnPanic is called with each panic recovered in the middlewares, the HTTPClient, the spider,
+	// the item pipelines and the WorkerQueue. Nil disables it.
+	OnPanic func(err *PanicError)
+	// RestartOnPanic makes the stage that recovered a panic go on to the next request.
+	// Otherwise, the worker stops as if Shutdown is called and Start returns the PanicError.
+	RestartOnPanic bool
+
+	mutex sync.Mutex
+	// panicErr is the first panic that stopped the running worker.
+	panicErr *PanicError
+	// stop cancels the subscription of the running worker.
+	stop context.CancelFunc
+	// abort cancels the in-flight fetches of the running worker.
+	abort    context.CancelFunc
+	abortCtx context.Context
+	done     chan struct{}
 }
 
 func newWorker(
@@ -39,8 +80,35 @@ func newWorker(
 }
 
 // Start kicks worker off.
+// It runs until ctx is done or Shutdown is called, and returns nil after the pipeline is drained:
+// the subscribed requests are processed, the output of Spider is published,
+// and the ItemPipelines that implement io.Closer are closed.
 func (w *Worker) Start(ctx context.Context) error {
-	requestPipeline, err := w.subscribe(ctx)
+	return w.run(ctx, nil)
+}
+
+// StartWithFirstRequest kicks worker off with first request.
+func (w *Worker) StartWithFirstRequest(ctx context.Context, URL string) error {
+	request, err := NewGetRequest(URL)
+	if err != nil {
+		return xerrors.Errorf("fail to create initial request: %v", err)
+	}
+	return w.run(ctx, request)
+}
+
+func (w *Worker) run(ctx context.Context, firstRequest *Request) error {
+	subscribeCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	done := make(chan struct{})
+	defer close(done)
+	w.mutex.Lock()
+	w.stop, w.abort, w.abortCtx, w.done = stop, abort, abortCtx, done
+	w.panicErr = nil
+	w.mutex.Unlock()
+
+	requestPipeline, err := w.subscribe(subscribeCtx)
 	if err != nil {
 		return xerrors.Errorf("fail to subscribe request: %v", err)
 	}
@@ -52,33 +120,94 @@ func (w *Worker) Start(ctx context.Context) error {
 	if err != nil {
 		return xerrors.Errorf("fail to initialize spider pipeline: %v", err)
 	}
-	err = w.publishRequest(nextRequestPipeline)
-	return xerrors.Errorf("fail to publish request: %v", err)
-}
+	if firstRequest != nil {
+		nextRequestPipeline <- &spiderResult{requests: []*Request{firstRequest}}
+	}
 
-// StartWithFirstRequest kicks worker off with first request.
-func (w *Worker) StartWithFirstRequest(ctx context.Context, URL string) error {
-	requestPipeline, err := w.subscribe(ctx)
+	err = w.publishRequest(nextRequestPipeline)
 	if err != nil {
-		return xerrors.Errorf("fail to subscribe request: %v", err)
+		return xerrors.Errorf("fail to publish request: %v", err)
 	}
-	responsePipeline, err := w.doRequest(requestPipeline)
+	err = w.closeItemPipelines()
 	if err != nil {
-		return xerrors.Errorf("fail to initialize request pipeline: %v", err)
+		return xerrors.Errorf("fail to flush item pipelines: %v", err)
 	}
-	nextRequestPipeline, err := w.applySpider(responsePipeline)
-	if err != nil {
-		return xerrors.Errorf("fail to initialize spider pipeline: %v", err)
+	w.mutex.Lock()
+	panicErr := w.panicErr
+	w.mutex.Unlock()
+	if panicErr != nil {
+		return xerrors.Errorf("worker is stopped: %w", panicErr)
 	}
+	return nil
+}
 
-	request, err := NewGetRequest(URL)
+// Shutdown stops subscribing new requests and waits until Start returns after draining the pipeline.
+// If ctx is done before that, the in-flight fetches are aborted and their requests are put back to the WorkerQueue,
+// and Shutdown returns the error of ctx after Start returns.
+// Shutdown returns nil immediately if the worker is not running.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.mutex.Lock()
+	stop, abort, done := w.stop, w.abort, w.done
+	w.mutex.Unlock()
+	if done == nil {
+		return nil
+	}
+	stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	w.Logger.Warnf("abort in-flight requests: %v", ctx.Err())
+	abort()
+	<-done
+	return xerrors.Errorf("fail to drain in-flight requests: %w", ctx.Err())
+}
+
+// aborted reports whether Shutdown aborted the in-flight fetches.
+func (w *Worker) aborted() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.abortCtx != nil && w.abortCtx.Err() != nil
+}
+
+// fetchContext returns the context of the fetches, which is done when Shutdown aborts them.
+func (w *Worker) fetchContext() context.Context {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.abortCtx == nil {
+		return context.Background()
+	}
+	return w.abortCtx
+}
+
+// requeue puts the aborted request back to the WorkerQueue.
+func (w *Worker) requeue(request *Request) {
+	var err error
+	if queue, ok := w.WorkerQueue.(AckingWorkerQueue); ok {
+		err = queue.Nack(request)
+	} else {
+		err = w.WorkerQueue.RetryRequest(request)
+	}
 	if err != nil {
-		return xerrors.Errorf("fail to create initial request: %v", err)
+		w.Logger.Errorf("fail to requeue %s. this request is lost: %v", request.URL, err)
 	}
-	nextRequestPipeline <- request
+}
 
-	err = w.publishRequest(nextRequestPipeline)
-	return xerrors.Errorf("fail to publish request: %v", err)
+// closeItemPipelines closes the ItemPipelines that implement io.Closer so that they flush their items.
+func (w *Worker) closeItemPipelines() error {
+	var firstErr error
+	for _, pipeline := range w.ItemPipelines {
+		closer, ok := pipeline.(io.Closer)
+		if !ok {
+			continue
+		}
+		err := closer.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 func (w *Worker) subscribe(ctx context.Context) (<-chan *Request, error) {
@@ -101,69 +230,93 @@ func (w *Worker) subscribe(ctx context.Context) (<-chan *Request, error) {
 
 func (w *Worker) doRequest(requestChan <-chan *Request) (<-chan *Response, error) {
 	responseChan := make(chan *Response, channelSize)
+	client := w.httpClient()
 
-	// TODO: add goroutine supervisor
 	go func() {
 		defer close(responseChan)
 
 		requestWaitGroup := sync.WaitGroup{}
 
-		for request := range requestChan {
-
-			handleRequest := func(request *Request) {
-				defer requestWaitGroup.Done()
+		handleRequest := func(request *Request) {
+			ctx := w.fetchContext()
 
-				// apply requestMiddlewares
-				for _, middlewareFunc := range w.RequestMiddlewares {
-					middlewareFunc(request)
+			// apply requestMiddlewares
+			var response *Response
+			var fetchErr error
+			fetched := false
+			decision, err := w.processRequest(ctx, request)
+			switch {
+			case err != nil && w.aborted():
+				w.Logger.Infof("requeue aborted request %s", request.URL)
+				w.release(request)
+				w.requeue(request)
+				return
+			case err != nil:
+				w.Logger.Warnf("fail to process request %s: %v", request.URL, err)
+			case decision.Action == ActionDrop:
+				w.Logger.Debugf("drop %s", request.URL)
+				w.release(request)
+				w.acknowledge(request, true)
+				return
+			case decision.Action == ActionRetryLater:
+				w.release(request)
+				w.retryLater(request, decision.Delay)
+				return
+			case decision.Action == ActionRespond:
+				response = decision.Response
+				if response != nil {
+					response.setSubscribed(request)
 				}
-
-				var requestRetry bool
+			case !request.isRetry():
 				// send request
-				var response *Response
-				if retry, ok := request.Meta["retry"]; ok {
-					if retryFlag, ok := retry.(bool); retryFlag && ok {
-						requestRetry = true
-					}
-				}
-				if !requestRetry {
-					httpRequest, err := request.HTTPRequest()
-					if err != nil {
-						w.Logger.Warnf("fail to construct http.Request. %v: %v", request, err)
-					} else {
-						w.Logger.Debugf("request %s", httpRequest.URL.String())
-						httpResponse, err := w.HTTPClient.Do(httpRequest)
-						if err != nil {
-							w.Logger.Warnf("fail to get http.Response of http.Request(%v): %v", request, err)
-						} else {
-							response, err = NewResponseFromHTTPResponse(httpResponse)
-							if err != nil {
-								w.Logger.Warnf("fail to construct Response of http.Response(%v): %v", httpResponse, err)
-							}
-						}
-					}
+				response, fetchErr = w.send(ctx, client, request)
+				fetched = true
+				var retryLaterErr *RetryLaterError
+				if fetchErr != nil && w.aborted() {
+					w.Logger.Infof("requeue aborted request %s", request.URL)
+					w.release(request)
+					w.requeue(request)
+					return
+				} else if xerrors.As(fetchErr, &retryLaterErr) {
+					w.release(request)
+					w.retryLater(request, retryLaterErr.Delay)
+					return
+				} else if fetchErr != nil {
+					w.Logger.Warnf("fail to get http.Response of http.Request(%v): %v", request, fetchErr)
 				}
+			}
 
-				if response == nil {
-					// set dummy response
-					response = &Response{
-						StatusCode: 0,
-						Headers:    map[string][]string{},
-						Body:       nil,
-						Request:    request,
-					}
-				}
+			if response == nil {
+				response = dummyResponse(request)
+			}
 
-				// apply responseMiddlewares
-				for _, middlewareFunc := range w.ResponseMiddlewares {
-					middlewareFunc(response)
-				}
+			w.applyResponseMiddlewares(response)
 
-				responseChan <- response
+			if fetched && w.retry(request, response, fetchErr) {
+				return
 			}
 
-			requestWaitGroup.Add(1)
-			go handleRequest(request)
+			responseChan <- response
+		}
+
+		if w.FetchConcurrency > 0 {
+			for i := 0; i < w.FetchConcurrency; i++ {
+				requestWaitGroup.Add(1)
+				go func() {
+					defer requestWaitGroup.Done()
+					for request := range requestChan {
+						w.fetch(request, handleRequest)
+					}
+				}()
+			}
+		} else {
+			for request := range requestChan {
+				requestWaitGroup.Add(1)
+				go func(request *Request) {
+					defer requestWaitGroup.Done()
+					w.fetch(request, handleRequest)
+				}(request)
+			}
 		}
 
 		requestWaitGroup.Wait()
@@ -172,48 +325,309 @@ func (w *Worker) doRequest(requestChan <-chan *Request) (<-chan *Response, error
 	return responseChan, nil
 }
 
-func (w *Worker) applySpider(responseChan <-chan *Response) (chan *Request, error) {
-	requestChan := make(chan *Request, channelSize)
+// dummyResponse is the response of a request that is not fetched or whose fetch fails.
+func dummyResponse(request *Request) *Response {
+	return &Response{
+		StatusCode: 0,
+		Headers:    map[string][]string{},
+		Body:       nil,
+		Request:    request,
+	}
+}
+
+func (w *Worker) applyResponseMiddlewares(response *Response) {
+	for _, middlewareFunc := range w.ResponseMiddlewares {
+		middlewareFunc(response)
+	}
+}
+
+// release applies ResponseMiddlewares to the dummy response of the request that leaves the pipeline
+// without a response, so that the pairs of RequestMiddlewares and ResponseMiddlewares release what they acquired.
+func (w *Worker) release(request *Request) {
+	w.applyResponseMiddlewares(dummyResponse(request))
+}
+
+// processRequest applies RequestMiddlewares and then Middlewares until one of them does not continue.
+func (w *Worker) processRequest(ctx context.Context, request *Request) (Decision, error) {
+	for _, middlewareFunc := range w.RequestMiddlewares {
+		decision, err := AdaptRequestMiddleware(middlewareFunc).ProcessRequest(ctx, request)
+		if err != nil || decision.Action != ActionContinue {
+			return decision, err
+		}
+	}
+	if request.isRetry() {
+		// the request is not fetched, so the Middlewares must not acquire anything for it.
+		return Continue(), nil
+	}
+	for _, middleware := range w.Middlewares {
+		decision, err := middleware.ProcessRequest(ctx, request)
+		if err != nil || decision.Action != ActionContinue {
+			return decision, err
+		}
+	}
+	return Continue(), nil
+}
+
+// send fetches the request through client, which is HTTPClient wrapped with DownloaderMiddlewares.
+// It returns the error of the HTTPClient, and nil without error if the Response cannot be constructed.
+func (w *Worker) send(ctx context.Context, client HTTPClient, request *Request) (*Response, error) {
+	httpRequest, err := request.HTTPRequest()
+	if err != nil {
+		w.Logger.Warnf("fail to construct http.Request. %v: %v", request, err)
+		return nil, nil
+	}
+	w.Logger.Debugf("request %s", httpRequest.URL.String())
+	ctx = context.WithValue(ctx, requestContextKey{}, request)
+	httpResponse, err := client.Do(httpRequest.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	response, err := NewResponseFromHTTPResponse(httpResponse)
+	if err != nil {
+		w.Logger.Warnf("fail to construct Response of http.Response(%v): %v", httpResponse, err)
+		return nil, nil
+	}
+	// keep the subscribed request so that the queue can identify it and Meta reaches the spider.
+	response.setSubscribed(request)
+	return response, nil
+}
+
+// httpClient returns HTTPClient wrapped with DownloaderMiddlewares.
+func (w *Worker) httpClient() HTTPClient {
+	if len(w.DownloaderMiddlewares) == 0 {
+		return w.HTTPClient
+	}
+	return ChainDownloaderMiddlewares(w.HTTPClient, w.DownloaderMiddlewares...)
+}
+
+// retryLater puts a copy of the request back to the WorkerQueue to be fetched after delay, and acks the request.
+func (w *Worker) retryLater(request *Request, delay time.Duration) {
+	retryRequest := request.clone()
+	delete(retryRequest.Meta, "retry")
+	retryRequest.NotBefore = time.Now().Add(delay)
+	w.Logger.Debugf("retry %s after %v", request.URL, delay)
+	err := w.WorkerQueue.RetryRequest(retryRequest)
+	if err != nil {
+		w.Logger.Errorf("fail to retry %s: %v", request.URL, err)
+		w.acknowledge(request, false)
+		return
+	}
+	w.acknowledge(request, true)
+}
+
+// fetch calls handleRequest under supervision, and gives up the request if it panics.
+func (w *Worker) fetch(request *Request, handleRequest func(request *Request)) {
+	panicErr := w.supervise("fetch", request, func() {
+		handleRequest(request)
+	})
+	if panicErr != nil {
+		w.giveUp(request, panicErr)
+	}
+}
+
+// spiderResult is the requests that Spider extracted from the response of a subscribed request.
+type spiderResult struct {
+	// request is the subscribed request, or nil if the requests are not extracted from a response.
+	request  *Request
+	requests []*Request
+}
 
+func (w *Worker) applySpider(responseChan <-chan *Response) (chan *spiderResult, error) {
+	resultChan := make(chan *spiderResult, channelSize)
+
+	concurrency := w.SpiderConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	spiderWaitGroup := sync.WaitGroup{}
+	spiderWaitGroup.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer spiderWaitGroup.Done()
+			w.spiderLoop(responseChan, resultChan)
+		}()
+	}
 	go func() {
-		defer close(requestChan)
-		for response := range responseChan {
-			w.Logger.Debugf("apply Spider to %s", response.Request.URL)
-			nextRequests, err := w.Spider(response)
-			if err != nil {
-				w.Logger.Infof("spider error: %v", err)
+		spiderWaitGroup.Wait()
+		close(resultChan)
+	}()
+
+	return resultChan, nil
+}
+
+func (w *Worker) spiderLoop(responseChan <-chan *Response, resultChan chan<- *spiderResult) {
+	for response := range responseChan {
+		w.Logger.Debugf("apply Spider to %s", response.Request.URL)
+		output := &SpiderOutput{}
+		var err error
+		// a panicking spider outputs nothing and its request is acked like a spider error.
+		w.supervise("spider", response.Request, func() {
+			output, err = w.spider(response)
+		})
+		if err != nil {
+			w.Logger.Infof("spider error: %v", err)
+		}
+		for _, item := range output.Items {
+			item := item
+			w.supervise("item pipeline", response.Request, func() {
+				w.processItem(item, response)
+			})
+		}
+		resultChan <- &spiderResult{
+			request:  response.subscribedRequest(),
+			requests: output.Requests,
+		}
+	}
+}
+
+// spider applies ItemSpider, or Spider if ItemSpider is nil, to the response.
+// The output is not nil even if the spider fails.
+func (w *Worker) spider(response *Response) (*SpiderOutput, error) {
+	if w.ItemSpider == nil {
+		requests, err := w.Spider(response)
+		return &SpiderOutput{Requests: requests}, err
+	}
+	output, err := w.ItemSpider(response)
+	if output == nil {
+		output = &SpiderOutput{}
+	}
+	return output, err
+}
+
+// processItem passes the item through ItemPipelines in order until a stage drops it.
+func (w *Worker) processItem(item Item, response *Response) {
+	for _, pipeline := range w.ItemPipelines {
+		var err error
+		item, err = pipeline.ProcessItem(item, response)
+		if xerrors.Is(err, ErrDropItem) {
+			w.Logger.Debugf("drop item of %s", response.Request.URL)
+			return
+		} else if err != nil {
+			w.Logger.Warnf("fail to process item of %s: %v", response.Request.URL, err)
+			return
+		}
+	}
+}
+
+func (w *Worker) publishRequest(resultChan <-chan *spiderResult) error {
+	for result := range resultChan {
+		published := true
+		for _, request := range result.requests {
+			if w.seen(request) {
+				w.Logger.Debugf("drop duplicate %s", request.URL)
 				continue
 			}
-			for _, request := range nextRequests {
-				requestChan <- request
+			w.Logger.Debugf("publish %s", request.URL)
+			var err error
+			panicErr := w.supervise("publish", request, func() {
+				err = w.WorkerQueue.PublishRequest(request)
+			})
+			if panicErr != nil {
+				err = panicErr
+			}
+			if err != nil {
+				w.Logger.Errorf("fail to publish request: %s", request.URL)
+				published = false
+				continue
 			}
+			w.record(request)
 		}
-	}()
+		if result.request != nil {
+			w.acknowledge(result.request, published)
+		}
+	}
+	return nil
+}
+
+// seen reports whether DupeFilter has seen the request.
+// A request is regarded as unseen if DupeFilter fails so that it is not lost.
+func (w *Worker) seen(request *Request) bool {
+	if w.DupeFilter == nil {
+		return false
+	}
+	seen, err := w.DupeFilter.Seen(request)
+	if err != nil {
+		w.Logger.Warnf("fail to filter %s: %v", request.URL, err)
+		return false
+	}
+	return seen
+}
 
-	return requestChan, nil
+// record records the published request in DupeFilter.
+// A request that fails to be published is not recorded so that it can be published again.
+func (w *Worker) record(request *Request) {
+	if w.DupeFilter == nil {
+		return
+	}
+	err := w.DupeFilter.Record(request)
+	if err != nil {
+		w.Logger.Warnf("fail to record %s: %v", request.URL, err)
+	}
 }
 
-func (w *Worker) publishRequest(requestChan <-chan *Request) error {
-	for request := range requestChan {
-		w.Logger.Debugf("publish %s", request.URL)
-		err := w.WorkerQueue.PublishRequest(request)
+// acknowledge acks the subscribed request if the output of Spider is published, or nacks it otherwise,
+// when the WorkerQueue is an AckingWorkerQueue.
+// Note that a spider error does not nack the request because Spider would fail again.
+func (w *Worker) acknowledge(request *Request, published bool) {
+	queue, ok := w.WorkerQueue.(AckingWorkerQueue)
+	if !ok {
+		return
+	}
+	if published {
+		err := queue.Ack(request)
+		if err != nil {
+			w.Logger.Warnf("fail to ack %s: %v", request.URL, err)
+		}
+	} else {
+		err := queue.Nack(request)
 		if err != nil {
-			w.Logger.Errorf("fail to publish request: %s", request.URL)
+			w.Logger.Warnf("fail to nack %s: %v", request.URL, err)
 		}
 	}
-	return nil
 }
 
 // RetryMiddleware is request middleware that remove request in worker pipeline
 // and send request to worker queue if Request.Meta['retry'] flas is true.
+// The request is given up when it has been retried Worker.MaxAttempts times,
+// with the status code and the error of its last failed attempt if they are known.
 func (w *Worker) RetryMiddleware(request *Request) {
-	if retry, ok := request.Meta["retry"]; ok {
-		if retryFlag, ok := retry.(bool); retryFlag && ok {
-			w.Logger.Debugf("retry request %s", request.URL)
-			err := w.WorkerQueue.RetryRequest(request)
-			if err != nil {
-				w.Logger.Errorf("fail to retry %s. this request is lost.")
+	if request.isRetry() {
+		// the flag is kept for the rest of the pipeline, so retry a copy without it.
+		retryRequest := request.clone()
+		delete(retryRequest.Meta, "retry")
+		retryRequest.Attempts++
+		if w.MaxAttempts > 0 && retryRequest.Attempts > w.MaxAttempts {
+			statusCode, cause := request.lastFailure()
+			if cause == "" {
+				cause = "retry limit exceeded"
+			} else {
+				cause = "retry limit exceeded: " + cause
 			}
+			w.deadLetter(retryRequest, statusCode, cause)
+			return
 		}
+		w.Logger.Debugf("retry request %s", request.URL)
+		err := w.WorkerQueue.RetryRequest(retryRequest)
+		if err != nil {
+			w.Logger.Errorf("fail to retry %s. this request is lost.", request.URL)
+		}
+	}
+}
+
+// deadLetter sends the request that exhausted its retries to the WorkerQueue if it is a DeadLetterQueue.
+func (w *Worker) deadLetter(request *Request, statusCode int, cause string) {
+	queue, ok := w.WorkerQueue.(DeadLetterQueue)
+	if !ok {
+		w.Logger.Warnf("give up %s after %d attempts: %s", request.URL, request.Attempts, cause)
+		return
+	}
+	w.Logger.Infof("send %s to dead letter queue after %d attempts: %s", request.URL, request.Attempts, cause)
+	err := queue.PublishDeadLetter(&DeadLetter{
+		Request:    request,
+		StatusCode: statusCode,
+		Error:      cause,
+	})
+	if err != nil {
+		w.Logger.Errorf("fail to publish dead letter %s. this request is lost: %v", request.URL, err)
 	}
 }
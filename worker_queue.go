@@ -10,3 +10,44 @@ type WorkerQueue interface {
 	RetryRequest(request *Request) error
 	PublishRequest(request *Request) error
 }
+
+// AckingWorkerQueue is a WorkerQueue that keeps track of subscribed requests
+// and delivers them again unless they are acknowledged.
+type AckingWorkerQueue interface {
+	WorkerQueue
+	// Ack tells the queue that the request has been processed.
+	Ack(request *Request) error
+	// Nack tells the queue that the request has not been processed and should be delivered again.
+	Nack(request *Request) error
+}
+
+// DeadLetter is a request that exhausted its retries.
+type DeadLetter struct {
+	Request *Request
+	// StatusCode is the status code of the last attempt, or 0 if the last attempt got no response.
+	StatusCode int
+	// Error describes why the last attempt failed.
+	Error string
+}
+
+// DeadLetterQueue is a WorkerQueue that keeps requests that exhausted their retries
+// so that they can be inspected and re-injected.
+type DeadLetterQueue interface {
+	WorkerQueue
+	// PublishDeadLetter stores the dead letter.
+	PublishDeadLetter(letter *DeadLetter) error
+	// DeadLetters returns the stored dead letters.
+	DeadLetters() ([]*DeadLetter, error)
+	// DeadLetter returns the dead letter of the request with the fingerprint, or nil if it does not exist.
+	DeadLetter(fingerprint string) (*DeadLetter, error)
+	// ReinjectDeadLetter removes the dead letter of the request with the fingerprint
+	// and publishes its request again with Attempts reset.
+	ReinjectDeadLetter(fingerprint string) error
+}
+
+// InspectableWorkerQueue is a WorkerQueue that can list its pending requests.
+type InspectableWorkerQueue interface {
+	WorkerQueue
+	// PendingRequests returns the requests that are published but not consumed yet.
+	PendingRequests() ([]*Request, error)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"golang.org/x/xerrors"
@@ -218,16 +221,79 @@ func TestWorker_applySpiderReturnNewRequests(t *testing.T) {
 
 	requestCounter := 0
 	for returnValue := range returnValueChan {
-		if returnValue.URL != requestURL {
-			t.Fatalf("expect no response, got %s", returnValue.URL)
+		for _, request := range returnValue.requests {
+			if request.URL != requestURL {
+				t.Fatalf("expect no response, got %s", request.URL)
+			}
+			requestCounter++
 		}
-		requestCounter++
 	}
 	if requestCounter != 300 {
 		t.Fatalf("expect requestCounter == 300, but got %d", requestCounter)
 	}
 }
 
+func TestWorker_applySpiderItemPipelines(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Warnf(gomock.Any(), gomock.Any()).Times(1)
+
+	next, _ := NewGetRequest("https://golang.org/doc/")
+	worker := newWorker(
+		nil,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+	worker.ItemSpider = func(response *Response) (*SpiderOutput, error) {
+		return &SpiderOutput{
+			Requests: []*Request{next},
+			Items:    []Item{{"title": "Go"}, {"title": ""}, {"title": "invalid"}},
+		}, nil
+	}
+	stored := make([]Item, 0)
+	worker.ItemPipelines = []ItemPipeline{
+		ItemPipelineFunc(func(item Item, response *Response) (Item, error) {
+			if item["title"] == "" {
+				return nil, ErrDropItem
+			}
+			if item["title"] == "invalid" {
+				return nil, xerrors.New("invalid title")
+			}
+			return item, nil
+		}),
+		ItemPipelineFunc(func(item Item, response *Response) (Item, error) {
+			item["url"] = response.Request.URL
+			return item, nil
+		}),
+		ItemPipelineFunc(func(item Item, response *Response) (Item, error) {
+			stored = append(stored, item)
+			return item, nil
+		}),
+	}
+
+	inputPipeline := make(chan *Response, 1)
+	inputPipeline <- &Response{Request: &Request{URL: "https://golang.org/"}}
+	close(inputPipeline)
+
+	resultChan, err := worker.applySpider(inputPipeline)
+	if err != nil {
+		t.Fatalf("expect err == nil, but got %v", err)
+	}
+	result := <-resultChan
+	if len(result.requests) != 1 || result.requests[0] != next {
+		t.Fatalf("expected the request of the spider output, but got %v", result.requests)
+	}
+	if len(stored) != 1 || stored[0]["title"] != "Go" || stored[0]["url"] != "https://golang.org/" {
+		t.Fatalf("unexpected stored items: %v", stored)
+	}
+}
+
 func TestWorker_applySpiderReturnError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -271,10 +337,10 @@ func TestWorker_applySpiderReturnError(t *testing.T) {
 
 	requestCounter := 0
 	for returnValue := range returnValueChan {
-		if returnValue != nil {
-			t.Fatalf("expect no result, but got %v", returnValue)
+		for _, request := range returnValue.requests {
+			t.Fatalf("expect no result, but got %v", request)
 		}
-		requestCounter++
+		requestCounter += len(returnValue.requests)
 	}
 	if requestCounter != 0 {
 		t.Fatalf("expect requestCounter == 0, but got %d", requestCounter)
@@ -301,12 +367,12 @@ func TestWorker_publishRequestPublish(t *testing.T) {
 
 	const requestNum = 100
 
-	inputPipeline := func() chan *Request {
-		output := make(chan *Request)
+	inputPipeline := func() chan *spiderResult {
+		output := make(chan *spiderResult)
 		go func() {
 			defer close(output)
 			for i := 0; i < requestNum; i++ {
-				output <- &Request{URL: "https://golang.org/"}
+				output <- &spiderResult{requests: []*Request{{URL: "https://golang.org/"}}}
 			}
 		}()
 		return output
@@ -326,6 +392,76 @@ func TestWorker_publishRequestPublish(t *testing.T) {
 	_ = worker.publishRequest(inputPipeline())
 }
 
+func TestWorker_publishRequestDupeFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	dupeFilterMock := NewMockDupeFilter(ctrl)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+	worker.DupeFilter = dupeFilterMock
+
+	seenRequest := &Request{URL: "https://golang.org/"}
+	newRequest := &Request{URL: "https://golang.org/doc/"}
+	inputPipeline := make(chan *spiderResult, 1)
+	inputPipeline <- &spiderResult{requests: []*Request{seenRequest, newRequest}}
+	close(inputPipeline)
+
+	dupeFilterMock.EXPECT().Seen(seenRequest).Return(true, nil)
+	gomock.InOrder(
+		dupeFilterMock.EXPECT().Seen(newRequest).Return(false, nil),
+		workerQueueMock.EXPECT().PublishRequest(newRequest).Return(nil),
+		dupeFilterMock.EXPECT().Record(newRequest).Return(nil),
+	)
+
+	_ = worker.publishRequest(inputPipeline)
+}
+
+func TestWorker_publishRequestDupeFilterFailToPublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Errorf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	dupeFilterMock := NewMockDupeFilter(ctrl)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+	worker.DupeFilter = dupeFilterMock
+
+	request := &Request{URL: "https://golang.org/"}
+	inputPipeline := make(chan *spiderResult, 1)
+	inputPipeline <- &spiderResult{requests: []*Request{request}}
+	close(inputPipeline)
+
+	// the request is not recorded, so it can be published again
+	dupeFilterMock.EXPECT().Seen(request).Return(false, nil)
+	dupeFilterMock.EXPECT().Record(request).Times(0)
+	workerQueueMock.EXPECT().PublishRequest(request).Return(errors.New("error"))
+
+	_ = worker.publishRequest(inputPipeline)
+}
+
 func TestWorker_publishRequestFailToPublish(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -346,12 +482,12 @@ func TestWorker_publishRequestFailToPublish(t *testing.T) {
 
 	const requestNum = 100
 
-	inputPipeline := func() chan *Request {
-		output := make(chan *Request)
+	inputPipeline := func() chan *spiderResult {
+		output := make(chan *spiderResult)
 		go func() {
 			defer close(output)
 			for i := 0; i < requestNum; i++ {
-				output <- &Request{URL: "https://golang.org/"}
+				output <- &spiderResult{requests: []*Request{{URL: "https://golang.org/"}}}
 			}
 		}()
 		return output
@@ -372,3 +508,416 @@ func TestWorker_publishRequestFailToPublish(t *testing.T) {
 
 	_ = worker.publishRequest(inputPipeline())
 }
+
+func TestWorker_publishRequestAcknowledge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Errorf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	workerQueueMock := NewMockAckingWorkerQueue(ctrl)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+
+	published := &Request{URL: "https://golang.org/"}
+	failed := &Request{URL: "https://golang.org/doc/"}
+
+	inputPipeline := func() chan *spiderResult {
+		output := make(chan *spiderResult)
+		go func() {
+			defer close(output)
+			output <- &spiderResult{request: published, requests: []*Request{{URL: "https://golang.org/pkg/"}}}
+			output <- &spiderResult{request: failed, requests: []*Request{{URL: "https://golang.org/blog/"}}}
+			output <- &spiderResult{requests: []*Request{{URL: "https://golang.org/help/"}}}
+		}()
+		return output
+	}
+
+	workerQueueMock.EXPECT().PublishRequest(
+		gomock.AssignableToTypeOf(&Request{}),
+	).DoAndReturn(
+		func(r *Request) error {
+			if r.URL == "https://golang.org/blog/" {
+				return errors.New("")
+			}
+			return nil
+		},
+	).Times(3)
+	workerQueueMock.EXPECT().Ack(published).Return(nil)
+	workerQueueMock.EXPECT().Nack(failed).Return(nil)
+
+	_ = worker.publishRequest(inputPipeline())
+}
+
+func TestWorker_RetryMiddlewareDeadLetter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Infof(gomock.Any(), gomock.Any()).AnyTimes()
+
+	workerQueueMock := NewMockDeadLetterQueue(ctrl)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+	worker.MaxAttempts = 2
+
+	request, _ := NewGetRequest("https://golang.org/")
+	request.Meta["retry"] = true
+	// the failure of the last attempt, as decoded from JSON
+	request.Meta["status_code"] = float64(503)
+	request.Meta["error"] = "status 503"
+
+	workerQueueMock.EXPECT().RetryRequest(gomock.AssignableToTypeOf(&Request{})).DoAndReturn(
+		func(r *Request) error {
+			if _, ok := r.Meta["retry"]; ok {
+				t.Fatalf("expect retry flag is removed")
+			}
+			request = r
+			request.Meta["retry"] = true
+			return nil
+		},
+	).Times(2)
+	workerQueueMock.EXPECT().PublishDeadLetter(gomock.AssignableToTypeOf(&DeadLetter{})).DoAndReturn(
+		func(letter *DeadLetter) error {
+			if letter.Request.Attempts != 3 {
+				t.Fatalf("expect 3 attempts, but got %d", letter.Request.Attempts)
+			}
+			if letter.StatusCode != 503 || letter.Error != "retry limit exceeded: status 503" {
+				t.Fatalf("expect the last failure, but got %d %s", letter.StatusCode, letter.Error)
+			}
+			return nil
+		},
+	)
+
+	for i := 0; i < 3; i++ {
+		worker.RetryMiddleware(request)
+	}
+}
+
+func TestWorker_StartReturnsNilOnCleanStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().SubscribeRequests(gomock.Any()).DoAndReturn(
+		func(ctx context.Context) (<-chan *Request, error) {
+			ch := make(chan *Request)
+			go func() {
+				<-ctx.Done()
+				close(ch)
+			}()
+			return ch, nil
+		},
+	)
+
+	worker := newWorker(
+		workerQueueMock,
+		nil,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		nil,
+	)
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	errChan := make(chan error)
+	go func() {
+		errChan <- worker.Start(ctx)
+	}()
+	cancelFunc()
+	if err := <-errChan; err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+}
+
+func TestWorker_ShutdownAbortsInFlightRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Infof(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Warnf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	request, _ := NewGetRequest("https://golang.org/")
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().SubscribeRequests(gomock.Any()).DoAndReturn(
+		func(ctx context.Context) (<-chan *Request, error) {
+			ch := make(chan *Request)
+			go func() {
+				defer close(ch)
+				ch <- request
+				<-ctx.Done()
+			}()
+			return ch, nil
+		},
+	)
+	workerQueueMock.EXPECT().RetryRequest(request).Return(nil)
+
+	fetching := make(chan struct{})
+	httpClientMock := NewMockHTTPClient(ctrl)
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(req *http.Request) (*http.Response, error) {
+			close(fetching)
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	)
+
+	worker := newWorker(
+		workerQueueMock,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		func(response *Response) ([]*Request, error) {
+			t.Fatalf("spider must not be applied to an aborted request")
+			return nil, nil
+		},
+	)
+
+	errChan := make(chan error)
+	go func() {
+		errChan <- worker.Start(context.Background())
+	}()
+	<-fetching
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelFunc()
+	err := worker.Shutdown(ctx)
+	if !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got %v", err)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+}
+
+func TestWorker_ShutdownReleasesPairedMiddlewares(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Infof(gomock.Any(), gomock.Any()).AnyTimes()
+	loggerMock.EXPECT().Warnf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	first, _ := NewGetRequest("https://golang.org/1")
+	second, _ := NewGetRequest("https://golang.org/2")
+	workerQueueMock := NewMockWorkerQueue(ctrl)
+	workerQueueMock.EXPECT().SubscribeRequests(gomock.Any()).DoAndReturn(
+		func(ctx context.Context) (<-chan *Request, error) {
+			ch := make(chan *Request)
+			go func() {
+				defer close(ch)
+				ch <- first
+				ch <- second
+				<-ctx.Done()
+			}()
+			return ch, nil
+		},
+	)
+	workerQueueMock.EXPECT().RetryRequest(gomock.Any()).Return(nil).Times(2)
+
+	fetching := make(chan struct{}, 2)
+	httpClientMock := NewMockHTTPClient(ctrl)
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(req *http.Request) (*http.Response, error) {
+			fetching <- struct{}{}
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	).Times(2)
+
+	// the second request waits for the counter held by the first one
+	counter := make(pairedCounter, 1)
+	worker := newWorker(
+		workerQueueMock,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){counter.requestMiddleware},
+		[]func(response *Response){counter.responseMiddleware},
+		func(response *Response) ([]*Request, error) {
+			t.Fatalf("spider must not be applied to an aborted request")
+			return nil, nil
+		},
+	)
+
+	errChan := make(chan error)
+	go func() {
+		errChan <- worker.Start(context.Background())
+	}()
+	<-fetching
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelFunc()
+	_ = worker.Shutdown(ctx)
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatalf("expected nil, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the worker to stop after the aborted requests release the counter")
+	}
+	if len(counter) != 0 {
+		t.Fatalf("expected the counter to be released")
+	}
+}
+
+// concurrencyCounter records the maximum number of concurrent calls.
+type concurrencyCounter struct {
+	mutex   sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrencyCounter) enter() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+}
+
+func (c *concurrencyCounter) leave() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current--
+}
+
+func TestWorker_Concurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	const requestNum = 30
+	fetchCounter := &concurrencyCounter{}
+	httpClientMock := NewMockHTTPClient(ctrl)
+	httpClientMock.EXPECT().Do(gomock.Any()).DoAndReturn(
+		func(req *http.Request) (*http.Response, error) {
+			fetchCounter.enter()
+			defer fetchCounter.leave()
+			time.Sleep(time.Millisecond)
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Request: req}, nil
+		},
+	).Times(requestNum)
+
+	spiderCounter := &concurrencyCounter{}
+	worker := newWorker(
+		nil,
+		httpClientMock,
+		loggerMock,
+		[]func(request *Request){},
+		[]func(response *Response){},
+		func(response *Response) ([]*Request, error) {
+			spiderCounter.enter()
+			defer spiderCounter.leave()
+			time.Sleep(time.Millisecond)
+			return nil, nil
+		},
+	)
+	worker.FetchConcurrency = 3
+	worker.SpiderConcurrency = 2
+
+	requestChan := make(chan *Request)
+	go func() {
+		defer close(requestChan)
+		for i := 0; i < requestNum; i++ {
+			r, _ := NewGetRequest("https://golang.org/")
+			requestChan <- r
+		}
+	}()
+	responseChan, _ := worker.doRequest(requestChan)
+	resultChan, _ := worker.applySpider(responseChan)
+	resultNum := 0
+	for range resultChan {
+		resultNum++
+	}
+
+	if resultNum != requestNum {
+		t.Fatalf("expected %d results, but got %d", requestNum, resultNum)
+	}
+	if fetchCounter.max > 3 || spiderCounter.max > 2 {
+		t.Fatalf("expected at most 3 fetches and 2 spiders, but got %d and %d", fetchCounter.max, spiderCounter.max)
+	}
+}
+
+func TestWorker_Redirect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	loggerMock := NewMockLogger(ctrl)
+	loggerMock.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer destination.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, destination.URL+"/page", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	request, _ := NewGetRequest(origin.URL + "/")
+	request.Depth = 1
+	request.Callback = "detail"
+	request.Meta["key"] = "value"
+
+	worker := newWorker(nil, &http.Client{}, loggerMock, nil, nil, func(response *Response) ([]*Request, error) {
+		return nil, nil
+	})
+	responses := doRequestOnce(t, worker, request)
+	if len(responses) != 1 {
+		t.Fatalf("expect a response, but got %v", responses)
+	}
+	response := responses[0]
+	if response.Request.URL != destination.URL+"/page" {
+		t.Fatalf("expect the fetched url, but got %s", response.Request.URL)
+	}
+	if response.Request.Depth != 1 || response.Request.Callback != "detail" || response.Request.Meta["key"] != "value" {
+		t.Fatalf("expect the fields of the subscribed request, but got %v", response.Request)
+	}
+
+	// links are resolved against the fetched url
+	next, err := response.FollowRequest("/next")
+	if err != nil {
+		t.Fatalf("fail to follow: %v", err)
+	}
+	if next.URL != destination.URL+"/next" || next.Referer != destination.URL+"/page" || next.Depth != 2 {
+		t.Fatalf("expect a child of the fetched url, but got %s %s %d", next.URL, next.Referer, next.Depth)
+	}
+
+	// the subscribed request is acked
+	responseChan := make(chan *Response, 1)
+	responseChan <- response
+	close(responseChan)
+	resultChan, _ := worker.applySpider(responseChan)
+	result := <-resultChan
+	if result.request != request {
+		t.Fatalf("expect the subscribed request, but got %v", result.request)
+	}
+}